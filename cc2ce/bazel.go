@@ -0,0 +1,172 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+// This file contains the reading of the CppCompile actions of a
+// "bazel aquery --output=jsonproto" dump. Bazel runs the compiler in the
+// execroot, all paths in the dump are relative to it.
+
+package cc2ce
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// BazelPaths tells where the paths of an aquery dump are on disk.
+//   - OutputBase is what "bazel info output_base" prints
+//   - Workspace is the name of the execroot directory of the main
+//     repository, "_main" with bzlmod (the workspace name before)
+//   - SourceRoot is where the sources of the main repository are. If empty,
+//     they are taken from the execroot, which links to them.
+type BazelPaths struct {
+	OutputBase string
+	Workspace  string
+	SourceRoot string
+}
+
+// BazelDefaultWorkspace is the name of the main repository when none is
+// given in BazelPaths.
+const BazelDefaultWorkspace = "_main"
+
+// ExecRoot returns the directory in which Bazel runs the compiler.
+func (p BazelPaths) ExecRoot() string {
+	workspace := p.Workspace
+	if workspace == "" {
+		workspace = BazelDefaultWorkspace
+	}
+	return filepath.Join(p.OutputBase, "execroot", workspace)
+}
+
+// Resolve turns an execroot relative path into the real location:
+//   - external/... (other repositories) into the output base
+//   - bazel-out/... (generated files) into the execroot
+//   - anything else (the main repository) into SourceRoot, if given, and
+//     the execroot otherwise
+//
+// Absolute paths are returned as they are.
+func (p BazelPaths) Resolve(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	clean := filepath.ToSlash(filepath.Clean(path))
+	switch {
+	case clean == "external" || strings.HasPrefix(clean, "external/"):
+		return filepath.Join(p.OutputBase, path)
+	case clean == "bazel-out" || strings.HasPrefix(clean, "bazel-out/"):
+		return filepath.Join(p.ExecRoot(), path)
+	case p.SourceRoot != "":
+		return filepath.Join(p.SourceRoot, path)
+	}
+	return filepath.Join(p.ExecRoot(), path)
+}
+
+// resolveArgs returns a copy of a compiler call in which the compiler and
+// the paths of the include related flags are resolved (see Resolve).
+func (p BazelPaths) resolveArgs(args []string) ([]string, error) {
+	resolved := append([]string{}, args...)
+	if len(resolved) != 0 && strings.Contains(resolved[0], "/") {
+		resolved[0] = p.Resolve(resolved[0])
+	}
+	for i := 1; i < len(resolved); i++ {
+		if resolved[i] == "-I-" {
+			continue
+		}
+		f, val, n, err := matchIncludeFlag(resolved, i)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			continue
+		}
+		if f.action != addPrefixedDir && val != "" && !strings.HasPrefix(val, "=") && !strings.HasPrefix(val, "$SYSROOT") {
+			path := p.Resolve(val)
+			if f.action == setPrefix && strings.HasSuffix(val, "/") {
+				// -iwithprefix appends to the prefix as it is written
+				path += "/"
+			}
+			if n == 2 {
+				resolved[i+1] = path
+			} else {
+				resolved[i] = resolved[i][:len(resolved[i])-len(val)] + path
+			}
+		}
+		i += n - 1
+	}
+	return resolved, nil
+}
+
+type bazelAquery struct {
+	Actions []struct {
+		Mnemonic  string   `json:"mnemonic"`
+		Arguments []string `json:"arguments"`
+	} `json:"actions"`
+}
+
+// BazelAqueryTUsByBytes turns the CppCompile actions of an aquery dump
+// (bazel aquery --output=jsonproto 'mnemonic("CppCompile", //...)') into
+// a compilation database. The compiler, the include paths and the input
+// and output files are resolved with paths (see BazelPaths.Resolve), the
+// working directory is the execroot.
+func BazelAqueryTUsByBytes(inFileContent []byte, paths BazelPaths) ([]JsonTranslationunit, error) {
+	if paths.OutputBase == "" {
+		return nil, fmt.Errorf("no bazel output base given (see bazel info output_base)")
+	}
+	var dump bazelAquery
+	if err := json.Unmarshal(inFileContent, &dump); err != nil {
+		return nil, fmt.Errorf("malformed aquery dump: %v", err)
+	}
+	var db []JsonTranslationunit
+	for _, action := range dump.Actions {
+		if action.Mnemonic != "CppCompile" {
+			continue
+		}
+		args, err := paths.resolveArgs(action.Arguments)
+		if err != nil {
+			return db, err
+		}
+		tu := JsonTranslationunit{Builddir: paths.ExecRoot(), Arguments: args}
+		for i := 0; i+1 < len(args); i++ {
+			switch args[i] {
+			case "-c":
+				args[i+1] = paths.Resolve(args[i+1])
+				tu.File = args[i+1]
+			case "-o":
+				args[i+1] = paths.Resolve(args[i+1])
+				tu.Output = args[i+1]
+			}
+		}
+		if tu.File == "" {
+			return db, fmt.Errorf("CppCompile action without input file: %s", JoinArguments(action.Arguments))
+		}
+		db = append(db, tu)
+	}
+	if len(db) == 0 {
+		return db, fmt.Errorf("no CppCompile actions in aquery dump")
+	}
+	return db, nil
+}
+
+// BazelAqueryTUsByFilename reads an aquery dump, see BazelAqueryTUsByBytes.
+func BazelAqueryTUsByFilename(inFileName string, paths BazelPaths) ([]JsonTranslationunit, error) {
+	content, err := ioutil.ReadFile(inFileName)
+	if err != nil {
+		return nil, err
+	}
+	db, err := BazelAqueryTUsByBytes(content, paths)
+	if err != nil {
+		return db, fmt.Errorf("%s: %w", inFileName, err)
+	}
+	return db, nil
+}
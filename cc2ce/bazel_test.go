@@ -0,0 +1,201 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+package cc2ce
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// bazelFixture is the dump of
+// bazel aquery --output=jsonproto 'mnemonic("CppCompile", //...)', with
+// one compilation in the main repository and one in the external zlib.
+var bazelFixture = filepath.Join("testdata", "bazel", "aquery.json")
+
+func TestBazelPathsResolve(t *testing.T) {
+	tests := []struct {
+		paths BazelPaths
+		path  string
+		want  string
+	}{
+		{BazelPaths{OutputBase: "/ob"}, "external/zlib/include", "/ob/external/zlib/include"},
+		{BazelPaths{OutputBase: "/ob"}, "external", "/ob/external"},
+		{BazelPaths{OutputBase: "/ob"}, "./external/zlib", "/ob/external/zlib"},
+		{BazelPaths{OutputBase: "/ob"}, "bazel-out/k8-opt/bin", "/ob/execroot/_main/bazel-out/k8-opt/bin"},
+		{BazelPaths{OutputBase: "/ob", Workspace: "ws"}, "bazel-out/k8-opt/bin", "/ob/execroot/ws/bazel-out/k8-opt/bin"},
+		{BazelPaths{OutputBase: "/ob"}, "lib/include", "/ob/execroot/_main/lib/include"},
+		{BazelPaths{OutputBase: "/ob"}, ".", "/ob/execroot/_main"},
+		{BazelPaths{OutputBase: "/ob", SourceRoot: "/src"}, "lib/include", "/src/lib/include"},
+		{BazelPaths{OutputBase: "/ob", SourceRoot: "/src"}, ".", "/src"},
+		// only the first path component counts
+		{BazelPaths{OutputBase: "/ob", SourceRoot: "/src"}, "externals/x", "/src/externals/x"},
+		{BazelPaths{OutputBase: "/ob", SourceRoot: "/src"}, "lib/external/x", "/src/lib/external/x"},
+		{BazelPaths{OutputBase: "/ob", SourceRoot: "/src"}, "bazel-outs", "/src/bazel-outs"},
+		{BazelPaths{OutputBase: "/ob", SourceRoot: "/src"}, "/usr/include", "/usr/include"},
+	}
+	for _, tt := range tests {
+		if got := tt.paths.Resolve(tt.path); got != tt.want {
+			t.Errorf("%+v: %s: got %q, want %q", tt.paths, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestBazelPathsResolveArgs(t *testing.T) {
+	paths := BazelPaths{OutputBase: "/ob", SourceRoot: "/src"}
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{
+			// joined forms
+			args: []string{"gcc", "-Iexternal/x", "-Ibazel-out/k8/bin", "-Ilib", "-isystemexternal/y", "-iquote."},
+			want: []string{"gcc", "-I/ob/external/x", "-I/ob/execroot/_main/bazel-out/k8/bin", "-I/src/lib", "-isystem/ob/external/y", "-iquote/src"},
+		},
+		{
+			// separated forms
+			args: []string{"gcc", "-I", "external/x", "-isystem", "external/y", "-iquote", "bazel-out/k8/bin", "-idirafter", "lib"},
+			want: []string{"gcc", "-I", "/ob/external/x", "-isystem", "/ob/external/y", "-iquote", "/ob/execroot/_main/bazel-out/k8/bin", "-idirafter", "/src/lib"},
+		},
+		{
+			// long forms
+			args: []string{"gcc", "--include-directory=external/x", "--include-directory-after=lib"},
+			want: []string{"gcc", "--include-directory=/ob/external/x", "--include-directory-after=/src/lib"},
+		},
+		{
+			// the compiler is resolved only if it is a path
+			args: []string{"external/tc/bin/gcc", "-Ilib"},
+			want: []string{"/ob/external/tc/bin/gcc", "-I/src/lib"},
+		},
+		{
+			args: []string{"gcc", "-Ilib"},
+			want: []string{"gcc", "-I/src/lib"},
+		},
+		{
+			// absolute, sysroot relative and -iwithprefix paths are kept, the
+			// -iprefix keeps its trailing slash
+			args: []string{"gcc", "-I/usr/include", "-I=/usr/local/include", "-I$SYSROOT/include", "-iprefix", "external/p/", "-iwithprefix", "include", "-I-", "-Ilib"},
+			want: []string{"gcc", "-I/usr/include", "-I=/usr/local/include", "-I$SYSROOT/include", "-iprefix", "/ob/external/p/", "-iwithprefix", "include", "-I-", "-I/src/lib"},
+		},
+		{
+			// other options are left alone
+			args: []string{"gcc", "-DX=external/x", "-std=c++17", "-O2"},
+			want: []string{"gcc", "-DX=external/x", "-std=c++17", "-O2"},
+		},
+	}
+	for _, tt := range tests {
+		got, err := paths.resolveArgs(tt.args)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %q, %v, want %q", tt.args, got, err, tt.want)
+		}
+	}
+
+	args := []string{"gcc", "-isystem"}
+	if _, err := paths.resolveArgs(args); err == nil {
+		t.Errorf("%q: no error for a missing argument", args)
+	}
+}
+
+func TestBazelAqueryTUsByFilename(t *testing.T) {
+	db, err := BazelAqueryTUsByFilename(bazelFixture, BazelPaths{OutputBase: "/ob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []JsonTranslationunit{
+		{
+			Builddir: "/ob/execroot/_main",
+			File:     "/ob/execroot/_main/lib/foo.cc",
+			Output:   "/ob/execroot/_main/bazel-out/k8-fastbuild/bin/lib/_objs/foo/foo.pic.o",
+			Arguments: []string{
+				"/ob/external/toolchain/bin/gcc",
+				"-U_FORTIFY_SOURCE",
+				"-iquote", "/ob/execroot/_main",
+				"-iquote", "/ob/execroot/_main/bazel-out/k8-fastbuild/bin",
+				"-iquote", "/ob/external/com_google_absl",
+				"-I/ob/external/zlib/include",
+				"-isystem", "/ob/external/boost",
+				"-isystem", "/usr/include/python3.11",
+				"-I/ob/execroot/_main/bazel-out/k8-fastbuild/bin/external/zlib/_virtual_includes/zlib",
+				"-I/ob/execroot/_main/lib/include",
+				"--sysroot=/ob/external/sysroot",
+				"-I=/usr/local/include",
+				"-std=c++17",
+				"-c", "/ob/execroot/_main/lib/foo.cc",
+				"-o", "/ob/execroot/_main/bazel-out/k8-fastbuild/bin/lib/_objs/foo/foo.pic.o",
+			},
+		},
+		{
+			Builddir: "/ob/execroot/_main",
+			File:     "/ob/external/zlib/adler32.c",
+			Output:   "/ob/execroot/_main/bazel-out/k8-fastbuild/bin/external/zlib/_objs/zlib/adler32.o",
+			Arguments: []string{
+				"/usr/bin/gcc",
+				"-iquote", "/ob/external/zlib",
+				"-c", "/ob/external/zlib/adler32.c",
+				"-o", "/ob/execroot/_main/bazel-out/k8-fastbuild/bin/external/zlib/_objs/zlib/adler32.o",
+			},
+		},
+	}
+	if !reflect.DeepEqual(db, want) {
+		t.Errorf("got %+v, want %+v", db, want)
+	}
+
+	// the include paths of the main repository come from its sources
+	db, err = BazelAqueryTUsByFilename(bazelFixture, BazelPaths{OutputBase: "/ob", SourceRoot: "/src"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirs, err := IncludeDirsFromArgs(db[0].Arguments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range dirs {
+		got = append(got, d.Path)
+	}
+	wantDirs := []string{
+		"/src",
+		"/ob/execroot/_main/bazel-out/k8-fastbuild/bin",
+		"/ob/external/com_google_absl",
+		"/ob/external/zlib/include",
+		"/ob/external/boost",
+		"/usr/include/python3.11",
+		"/ob/execroot/_main/bazel-out/k8-fastbuild/bin/external/zlib/_virtual_includes/zlib",
+		"/src/lib/include",
+		"/ob/external/sysroot/usr/local/include",
+	}
+	if !reflect.DeepEqual(got, wantDirs) {
+		t.Errorf("got include paths %q, want %q", got, wantDirs)
+	}
+	if db[0].File != "/src/lib/foo.cc" {
+		t.Errorf("got file %q", db[0].File)
+	}
+}
+
+func TestBazelAqueryTUsByBytesErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		paths   BazelPaths
+	}{
+		{"no output base", `{"actions": []}`, BazelPaths{}},
+		{"malformed", `{"actions": [`, BazelPaths{OutputBase: "/ob"}},
+		{"no compilations", `{"actions": [{"mnemonic": "CppLink", "arguments": ["gcc"]}]}`, BazelPaths{OutputBase: "/ob"}},
+		{"no input", `{"actions": [{"mnemonic": "CppCompile", "arguments": ["gcc", "-o", "a.o"]}]}`, BazelPaths{OutputBase: "/ob"}},
+	}
+	for _, tt := range tests {
+		if _, err := BazelAqueryTUsByBytes([]byte(tt.content), tt.paths); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+// This file contains the grouping of translation units by their compiler
+// options. In a Gaudi project, the options of component libraries (modules)
+// and linker libraries differ, and packages can have their own settings. So
+// instead of a single set of options, one set per group of translation units
+// is offered to the user.
+
+package cc2ce
+
+import (
+	"sort"
+	"strings"
+)
+
+// ClusterLabels maps options that distinguish clusters to a human readable
+// description for the cluster name. Options not listed here are used as
+// they are.
+var ClusterLabels = map[string]string{
+	"-DGAUDI_LINKER_LIBRARY": "linker library",
+}
+
+// OptionCluster is a group of translation units with (nearly) the same
+// compiler options.
+//   - Label describes what distinguishes the cluster from the others, it is
+//     empty for a cluster whose options are all shared with other clusters
+//   - Options is the options string for Compiler Explorer
+//   - Commands are the translation units in the cluster
+type OptionCluster struct {
+	Label    string
+	Options  string
+	Commands []CompileCommand
+
+	options []string
+}
+
+// Name derives a display name for the cluster, such as "Brunel (linker
+// library)".
+func (c OptionCluster) Name(base string) string {
+	if c.Label == "" {
+		return base
+	}
+	return base + " (" + c.Label + ")"
+}
+
+// ClusterByOptions groups translation units by their compiler options (as
+// selected by OptionsFromCommands, except that target specific defines with
+// a label in ClusterLabels, such as GAUDI_LINKER_LIBRARY, are not removed).
+// Translation units with identical options form a group. Groups whose
+// options differ by at most maxDistance options from those of a larger
+// group are merged into it (maxDistance 0 only groups identical options).
+// The options of a cluster are those of its largest group.
+//
+// Clusters are sorted by size, largest first.
+func ClusterByOptions(cmds []CompileCommand, maxDistance int, skippackagenameversion bool) []OptionCluster {
+	filter := optionFilter{skipPackageNameVersion: skippackagenameversion, keepTargetSpecific: func(define string) bool {
+		_, labelled := ClusterLabels["-D"+define]
+		return labelled
+	}}
+
+	type group struct {
+		options  []string
+		commands []CompileCommand
+	}
+	var groups []*group
+	bykey := make(map[string]*group)
+	for _, cc := range cmds {
+		options := cc.options(filter)
+		key := strings.Join(options, "\x00")
+		g, found := bykey[key]
+		if !found {
+			g = &group{options: options}
+			bykey[key] = g
+			groups = append(groups, g)
+		}
+		g.commands = append(g.commands, cc)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i].commands) > len(groups[j].commands)
+	})
+
+	var clusters []OptionCluster
+	for _, g := range groups {
+		merged := false
+		for i := range clusters {
+			if optionDistance(clusters[i].options, g.options) <= maxDistance {
+				clusters[i].Commands = append(clusters[i].Commands, g.commands...)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			clusters = append(clusters, OptionCluster{
+				Options:  strings.Join(g.options, " "),
+				Commands: g.commands,
+				options:  g.options,
+			})
+		}
+	}
+	sort.SliceStable(clusters, func(i, j int) bool {
+		return len(clusters[i].Commands) > len(clusters[j].Commands)
+	})
+
+	labelClusters(clusters)
+	return clusters
+}
+
+// optionDistance is the number of options in only one of a and b.
+func optionDistance(a, b []string) int {
+	ina := make(map[string]bool)
+	for _, o := range a {
+		ina[o] = true
+	}
+	inb := make(map[string]bool)
+	for _, o := range b {
+		inb[o] = true
+	}
+	distance := 0
+	for o := range ina {
+		if !inb[o] {
+			distance++
+		}
+	}
+	for o := range inb {
+		if !ina[o] {
+			distance++
+		}
+	}
+	return distance
+}
+
+// labelClusters sets the label of each cluster from the options which not
+// all clusters have.
+func labelClusters(clusters []OptionCluster) {
+	if len(clusters) < 2 {
+		return
+	}
+	common := make(map[string]int)
+	for _, c := range clusters {
+		seen := make(map[string]bool)
+		for _, o := range c.options {
+			if !seen[o] {
+				common[o]++
+			}
+			seen[o] = true
+		}
+	}
+	for i := range clusters {
+		var labels []string
+		seen := make(map[string]bool)
+		for _, o := range clusters[i].options {
+			if common[o] == len(clusters) || seen[o] {
+				continue
+			}
+			seen[o] = true
+			if l, found := ClusterLabels[o]; found {
+				labels = append(labels, l)
+			} else {
+				labels = append(labels, o)
+			}
+		}
+		clusters[i].Label = strings.Join(labels, ", ")
+	}
+}
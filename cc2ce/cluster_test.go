@@ -0,0 +1,161 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+package cc2ce
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// clusterCommands parses one translation unit per compiler call, each
+// with its own source file.
+func clusterCommands(t *testing.T, calls ...string) []CompileCommand {
+	var db []JsonTranslationunit
+	for i, call := range calls {
+		file := fmt.Sprintf("f%d.cpp", i)
+		db = append(db, JsonTranslationunit{Builddir: "/b", File: file, Command: call + " -c " + file})
+	}
+	cmds, err := CompileCommandsFromDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cmds
+}
+
+// clusterSummary is what a test expects of an OptionCluster.
+type clusterSummary struct {
+	Label    string
+	Options  string
+	Commands int
+}
+
+func summarizeClusters(clusters []OptionCluster) []clusterSummary {
+	var s []clusterSummary
+	for _, c := range clusters {
+		s = append(s, clusterSummary{Label: c.Label, Options: c.Options, Commands: len(c.Commands)})
+	}
+	return s
+}
+
+func TestClusterByOptionsDistance(t *testing.T) {
+	cmds := clusterCommands(t,
+		"g++ -O2 -DA", "g++ -O2 -DA -Wall", "g++ -O2 -DA",
+		"g++ -O3 -DB", "g++ -O2 -DA -Wall", "g++ -O2 -DA",
+	)
+	tests := []struct {
+		maxDistance int
+		want        []clusterSummary
+	}{
+		{0, []clusterSummary{
+			{"-O2, -DA", "-O2 -DA", 3},
+			{"-O2, -DA, -Wall", "-O2 -DA -Wall", 2},
+			{"-O3, -DB", "-O3 -DB", 1},
+		}},
+		// -Wall is one option more
+		{1, []clusterSummary{
+			{"-O2, -DA", "-O2 -DA", 5},
+			{"-O3, -DB", "-O3 -DB", 1},
+		}},
+		// -O3 -DB is four options away from -O2 -DA
+		{3, []clusterSummary{
+			{"-O2, -DA", "-O2 -DA", 5},
+			{"-O3, -DB", "-O3 -DB", 1},
+		}},
+		// a single cluster has no label
+		{4, []clusterSummary{
+			{"", "-O2 -DA", 6},
+		}},
+	}
+	for _, tt := range tests {
+		got := summarizeClusters(ClusterByOptions(cmds, tt.maxDistance, false))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("distance %d: got %+v, want %+v", tt.maxDistance, got, tt.want)
+		}
+	}
+}
+
+func TestClusterByOptionsLabels(t *testing.T) {
+	calls := []string{
+		"g++ -Dfoo_EXPORTS -DGAUDI_LINKER_LIBRARY -std=c++17 -O2",
+		"g++ -Dbar_EXPORTS -std=c++17 -O2",
+		"g++ -Dbaz_EXPORTS -std=c++17 -O2",
+	}
+	want := []clusterSummary{
+		{"", "-std=c++17 -O2", 2},
+		{"linker library", "-DGAUDI_LINKER_LIBRARY -std=c++17 -O2", 1},
+	}
+	wantNames := []string{"Brunel", "Brunel (linker library)"}
+	// the same clusters and labels, whatever the order of the translation
+	// units
+	for _, order := range [][]int{{0, 1, 2}, {1, 2, 0}, {2, 0, 1}} {
+		var ordered []string
+		for _, i := range order {
+			ordered = append(ordered, calls[i])
+		}
+		clusters := ClusterByOptions(clusterCommands(t, ordered...), 0, false)
+		if got := summarizeClusters(clusters); !reflect.DeepEqual(got, want) {
+			t.Errorf("order %v: got %+v, want %+v", order, got, want)
+			continue
+		}
+		for i, c := range clusters {
+			if got := c.Name("Brunel"); got != wantNames[i] {
+				t.Errorf("order %v: got name %q, want %q", order, got, wantNames[i])
+			}
+		}
+	}
+}
+
+func TestClusterByOptionsTies(t *testing.T) {
+	tests := []struct {
+		name        string
+		calls       []string
+		maxDistance int
+		want        []clusterSummary
+	}{
+		{
+			name:  "equal sizes keep the order of first use",
+			calls: []string{"g++ -O1", "g++ -O3", "g++ -O3", "g++ -O1"},
+			want: []clusterSummary{
+				{"-O1", "-O1", 2},
+				{"-O3", "-O3", 2},
+			},
+		},
+		{
+			name:  "equal sizes in the other order",
+			calls: []string{"g++ -O3", "g++ -O1", "g++ -O1", "g++ -O3"},
+			want: []clusterSummary{
+				{"-O3", "-O3", 2},
+				{"-O1", "-O1", 2},
+			},
+		},
+		{
+			name: "a group as close to two clusters joins the first",
+			calls: []string{
+				"g++ -O2", "g++ -O2 -DB", "g++ -O2 -DA",
+				"g++ -O2 -DB", "g++ -O2 -DA", "g++ -O2 -DB", "g++ -O2 -DA",
+			},
+			maxDistance: 1,
+			want: []clusterSummary{
+				{"-DB", "-O2 -DB", 4},
+				{"-DA", "-O2 -DA", 3},
+			},
+		},
+	}
+	for _, tt := range tests {
+		got := summarizeClusters(ClusterByOptions(clusterCommands(t, tt.calls...), tt.maxDistance, false))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+// This file contains the reading of the CMake File API reply (codemodel-v2
+// and the target objects). Unlike compile_commands.json, it keeps which
+// translation unit belongs to which target, and what the targets link.
+
+package cc2ce
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// cmakeReplyPath is where CMake writes the File API reply, relative to the
+// build directory.
+var cmakeReplyPath = filepath.Join(".cmake", "api", "v1", "reply")
+
+// CMakeDefaultCompilers are the compilers assumed per language when the
+// reply has no toolchains object (which CMake only writes from 3.20 on, and
+// only when queried).
+var CMakeDefaultCompilers = map[string]string{
+	"C":   "cc",
+	"CXX": "c++",
+}
+
+// CMakeTarget is what the CMake File API tells about a target on top of the
+// compiler calls.
+//   - Type is the CMake target type, e.g. "SHARED_LIBRARY" or "EXECUTABLE"
+//   - Languages are the languages of the target's compile groups
+//   - Includes and Defines are collected over all compile groups in order
+//   - Standard is the language standard, e.g. "c++17" as taken from the
+//     flags, or "17" when CMake only reports it separately
+//   - LinkLibraries are the library fragments of the link command
+//   - Sources are all source files of the target (including headers),
+//     with absolute paths
+type CMakeTarget struct {
+	Name          string
+	Type          string
+	Languages     []string
+	Includes      IncludeSet
+	Defines       []Define
+	Standard      string
+	LinkLibraries []string
+	Sources       []string
+}
+
+// CMakeCodemodel is the content of a CMake File API reply for one build
+// configuration. TranslationUnits can be processed like a compilation
+// database (e.g. with IncludesFromJsonByDB).
+type CMakeCodemodel struct {
+	Configuration    string
+	SourceDir        string
+	BuildDir         string
+	TranslationUnits []JsonTranslationunit
+	Targets          []CMakeTarget
+}
+
+type cmakeReplyObject struct {
+	Kind    string `json:"kind"`
+	Version struct {
+		Major int `json:"major"`
+		Minor int `json:"minor"`
+	} `json:"version"`
+	JsonFile string `json:"jsonFile"`
+}
+
+type cmakeIndex struct {
+	Objects []cmakeReplyObject `json:"objects"`
+}
+
+type cmakePaths struct {
+	Source string `json:"source"`
+	Build  string `json:"build"`
+}
+
+type cmakeCodemodelReply struct {
+	Paths          cmakePaths `json:"paths"`
+	Configurations []struct {
+		Name    string `json:"name"`
+		Targets []struct {
+			Name     string `json:"name"`
+			JsonFile string `json:"jsonFile"`
+		} `json:"targets"`
+	} `json:"configurations"`
+}
+
+type cmakeToolchainsReply struct {
+	Toolchains []struct {
+		Language string `json:"language"`
+		Compiler struct {
+			Path string `json:"path"`
+		} `json:"compiler"`
+	} `json:"toolchains"`
+}
+
+type cmakeCompileGroup struct {
+	Language         string `json:"language"`
+	LanguageStandard struct {
+		Standard string `json:"standard"`
+	} `json:"languageStandard"`
+	CompileCommandFragments []struct {
+		Fragment string `json:"fragment"`
+	} `json:"compileCommandFragments"`
+	Includes []struct {
+		Path     string `json:"path"`
+		IsSystem bool   `json:"isSystem"`
+	} `json:"includes"`
+	Defines []struct {
+		Define string `json:"define"`
+	} `json:"defines"`
+	Sysroot struct {
+		Path string `json:"path"`
+	} `json:"sysroot"`
+}
+
+type cmakeTargetReply struct {
+	Name    string     `json:"name"`
+	Type    string     `json:"type"`
+	Paths   cmakePaths `json:"paths"`
+	Sources []struct {
+		Path              string `json:"path"`
+		CompileGroupIndex *int   `json:"compileGroupIndex"`
+	} `json:"sources"`
+	CompileGroups []cmakeCompileGroup `json:"compileGroups"`
+	Link          struct {
+		CommandFragments []struct {
+			Fragment string `json:"fragment"`
+			Role     string `json:"role"`
+		} `json:"commandFragments"`
+	} `json:"link"`
+}
+
+// readCMakeReply decodes a json file of the reply directory.
+func readCMakeReply(replyDir, name string, v interface{}) error {
+	content, err := ioutil.ReadFile(filepath.Join(replyDir, name))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(content, v); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	return nil
+}
+
+// cmakeIndexFile returns the newest index file of the reply directory.
+// CMake names them index-<timestamp>.json, such that the newest one sorts
+// last.
+func cmakeIndexFile(replyDir string) (string, error) {
+	matches, err := filepath.Glob(filepath.Join(replyDir, "index-*.json"))
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		return "", fmt.Errorf("no CMake File API reply in %s (was a codemodel-v2 query placed in .cmake/api/v1/query before running cmake?)", replyDir)
+	}
+	sort.Strings(matches)
+	return filepath.Base(matches[len(matches)-1]), nil
+}
+
+// hasCMakeIndex tells if dir is a CMake File API reply directory.
+func hasCMakeIndex(dir string) bool {
+	matches, _ := filepath.Glob(filepath.Join(dir, "index-*.json"))
+	return len(matches) != 0
+}
+
+// cmakeReplyDir tells if inFileName refers to a CMake File API reply:
+// either the reply directory itself, or a build directory that contains a
+// reply but no compilation database.
+func cmakeReplyDir(inFileName string) (string, bool) {
+	info, err := os.Stat(inFileName)
+	if err != nil || !info.IsDir() {
+		return "", false
+	}
+	if hasCMakeIndex(inFileName) {
+		return inFileName, true
+	}
+	for _, n := range databaseNames {
+		if _, err := os.Stat(filepath.Join(inFileName, n)); err == nil {
+			return "", false
+		}
+	}
+	if candidate := filepath.Join(inFileName, cmakeReplyPath); hasCMakeIndex(candidate) {
+		return candidate, true
+	}
+	return "", false
+}
+
+// CMakeCodemodelByDirectory reads the CMake File API reply of a build
+// directory (or the reply directory itself). Of multi-config generators,
+// the configuration with the given name is read, or the first one if the
+// name is empty.
+//
+// The reply must contain a codemodel version 2, and may contain toolchains
+// to tell the compilers (see CMakeDefaultCompilers otherwise).
+func CMakeCodemodelByDirectory(dir string, configuration string) (CMakeCodemodel, error) {
+	replyDir := dir
+	if !hasCMakeIndex(dir) {
+		replyDir = filepath.Join(dir, cmakeReplyPath)
+	}
+
+	var model CMakeCodemodel
+	indexFile, err := cmakeIndexFile(replyDir)
+	if err != nil {
+		return model, err
+	}
+	var index cmakeIndex
+	if err := readCMakeReply(replyDir, indexFile, &index); err != nil {
+		return model, err
+	}
+
+	var codemodelFile, toolchainsFile string
+	for _, o := range index.Objects {
+		if o.Kind == "codemodel" && o.Version.Major == 2 {
+			codemodelFile = o.JsonFile
+		} else if o.Kind == "toolchains" && o.Version.Major == 1 {
+			toolchainsFile = o.JsonFile
+		}
+	}
+	if codemodelFile == "" {
+		return model, fmt.Errorf("%s: no codemodel version 2 in CMake File API reply", indexFile)
+	}
+
+	compilers := make(map[string]string)
+	for language, compiler := range CMakeDefaultCompilers {
+		compilers[language] = compiler
+	}
+	if toolchainsFile != "" {
+		var toolchains cmakeToolchainsReply
+		if err := readCMakeReply(replyDir, toolchainsFile, &toolchains); err != nil {
+			return model, err
+		}
+		for _, t := range toolchains.Toolchains {
+			if t.Compiler.Path != "" {
+				compilers[t.Language] = t.Compiler.Path
+			}
+		}
+	}
+
+	var codemodel cmakeCodemodelReply
+	if err := readCMakeReply(replyDir, codemodelFile, &codemodel); err != nil {
+		return model, err
+	}
+	model.SourceDir = codemodel.Paths.Source
+	model.BuildDir = codemodel.Paths.Build
+	found := false
+	for _, c := range codemodel.Configurations {
+		if configuration != "" && c.Name != configuration {
+			continue
+		}
+		found = true
+		model.Configuration = c.Name
+		for _, t := range c.Targets {
+			var target cmakeTargetReply
+			if err := readCMakeReply(replyDir, t.JsonFile, &target); err != nil {
+				return model, err
+			}
+			tus, info, err := target.translationUnits(model.SourceDir, model.BuildDir, compilers)
+			if err != nil {
+				return model, fmt.Errorf("target %s: %w", t.Name, err)
+			}
+			model.TranslationUnits = append(model.TranslationUnits, tus...)
+			model.Targets = append(model.Targets, info)
+		}
+		break
+	}
+	if !found {
+		return model, fmt.Errorf("no configuration %q in CMake File API reply", configuration)
+	}
+	return model, nil
+}
+
+// translationUnits turns the sources of a target into compilation database
+// entries, and summarises the target.
+func (t cmakeTargetReply) translationUnits(sourceDir, buildDir string, compilers map[string]string) ([]JsonTranslationunit, CMakeTarget, error) {
+	info := CMakeTarget{Name: t.Name, Type: t.Type}
+	directory := t.Paths.Build
+	if !filepath.IsAbs(directory) {
+		directory = filepath.Join(buildDir, directory)
+	}
+
+	// the compiler call of each compile group, without the source file
+	calls := make([][]string, len(t.CompileGroups))
+	for i, g := range t.CompileGroups {
+		compiler, found := compilers[g.Language]
+		if !found {
+			compiler = strings.ToLower(g.Language)
+		}
+		call := []string{compiler}
+		for _, d := range g.Defines {
+			call = append(call, "-D"+d.Define)
+		}
+		for _, inc := range g.Includes {
+			if inc.IsSystem {
+				call = append(call, "-isystem", inc.Path)
+			} else {
+				call = append(call, "-I"+inc.Path)
+			}
+		}
+		if g.Sysroot.Path != "" {
+			call = append(call, "--sysroot="+g.Sysroot.Path)
+		}
+		for _, f := range g.CompileCommandFragments {
+			words, err := SplitCommand(f.Fragment)
+			if err != nil {
+				return nil, info, err
+			}
+			call = append(call, words...)
+		}
+		calls[i] = call
+
+		cc, err := ParseCompileCommand(JsonTranslationunit{Builddir: directory, Arguments: call})
+		if err != nil {
+			return nil, info, err
+		}
+		info.Languages = append(info.Languages, g.Language)
+		info.Includes.AddTranslationUnit(cc.IncludePaths(true))
+		info.Defines = append(info.Defines, cc.Defines...)
+		if info.Standard == "" || g.Language == "CXX" {
+			if cc.Standard != "" {
+				info.Standard = cc.Standard
+			} else if g.LanguageStandard.Standard != "" {
+				info.Standard = g.LanguageStandard.Standard
+			}
+		}
+	}
+
+	var tus []JsonTranslationunit
+	for _, s := range t.Sources {
+		file := s.Path
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(sourceDir, file)
+		}
+		info.Sources = append(info.Sources, file)
+		if s.CompileGroupIndex == nil {
+			// headers and other files which don't get compiled
+			continue
+		}
+		if *s.CompileGroupIndex < 0 || *s.CompileGroupIndex >= len(calls) {
+			return nil, info, fmt.Errorf("%s: compile group %d does not exist", s.Path, *s.CompileGroupIndex)
+		}
+		args := append(append([]string{}, calls[*s.CompileGroupIndex]...), "-c", file)
+		tus = append(tus, JsonTranslationunit{Builddir: directory, File: file, Arguments: args})
+	}
+
+	for _, f := range t.Link.CommandFragments {
+		if f.Role != "libraries" {
+			continue
+		}
+		words, err := SplitCommand(f.Fragment)
+		if err != nil {
+			return nil, info, err
+		}
+		info.LinkLibraries = append(info.LinkLibraries, words...)
+	}
+	return tus, info, nil
+}
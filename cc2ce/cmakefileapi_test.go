@@ -0,0 +1,117 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+package cc2ce
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// cmakeFixture is a build directory with the reply of a Ninja Multi-Config
+// build, for the sources in /src and the build in /build.
+var cmakeFixture = filepath.Join("testdata", "cmake")
+
+func TestCMakeCodemodelByDirectory(t *testing.T) {
+	for _, dir := range []string{cmakeFixture, filepath.Join(cmakeFixture, cmakeReplyPath)} {
+		model, err := CMakeCodemodelByDirectory(dir, "")
+		if err != nil {
+			t.Fatalf("%s: %v", dir, err)
+		}
+		if model.Configuration != "Release" || model.SourceDir != "/src" || model.BuildDir != "/build" {
+			t.Errorf("%s: got configuration %q, source %q, build %q", dir, model.Configuration, model.SourceDir, model.BuildDir)
+		}
+
+		wantTUs := []JsonTranslationunit{
+			{
+				Builddir: "/build/foo",
+				File:     "/src/foo/a.cpp",
+				Arguments: []string{"/usr/bin/g++", "-Dfoo_EXPORTS", "-DX=1",
+					"-I/src/foo/inc", "-isystem", "/opt/boost/include",
+					"-O3", "-DNDEBUG", "-std=gnu++17", "-c", "/src/foo/a.cpp"},
+			},
+			{
+				Builddir: "/build",
+				File:     "/src/main.c",
+				Arguments: []string{"/usr/bin/gcc", "-I/src/foo/inc",
+					"-O3", "-DNDEBUG", "-c", "/src/main.c"},
+			},
+		}
+		if !reflect.DeepEqual(model.TranslationUnits, wantTUs) {
+			t.Errorf("%s: got translation units %+v, want %+v", dir, model.TranslationUnits, wantTUs)
+		}
+
+		if len(model.Targets) != 2 {
+			t.Fatalf("%s: got %d targets, want 2", dir, len(model.Targets))
+		}
+		foo, app := model.Targets[0], model.Targets[1]
+		if foo.Name != "foo" || foo.Type != "SHARED_LIBRARY" || foo.Standard != "gnu++17" {
+			t.Errorf("%s: got target %s of type %s with standard %q", dir, foo.Name, foo.Type, foo.Standard)
+		}
+		if want := []string{"/src/foo/a.cpp", "/src/foo/a.h"}; !reflect.DeepEqual(foo.Sources, want) {
+			t.Errorf("%s: got sources %q, want %q", dir, foo.Sources, want)
+		}
+		if want := []string{"-lboost_filesystem", "-lpthread"}; !reflect.DeepEqual(foo.LinkLibraries, want) {
+			t.Errorf("%s: got link libraries %q, want %q", dir, foo.LinkLibraries, want)
+		}
+		wantDefines := []Define{
+			{Name: "foo_EXPORTS"},
+			{Name: "X", Value: "1", HasValue: true},
+			{Name: "NDEBUG"},
+		}
+		if !reflect.DeepEqual(foo.Defines, wantDefines) {
+			t.Errorf("%s: got defines %+v, want %+v", dir, foo.Defines, wantDefines)
+		}
+		if !foo.Includes.Contains("/src/foo/inc") || !foo.Includes.Contains("/opt/boost/include") {
+			t.Errorf("%s: got includes %q", dir, foo.Includes.Paths())
+		}
+		// CMake only reports the standard of C separately here
+		if app.Name != "app" || app.Type != "EXECUTABLE" || app.Standard != "11" {
+			t.Errorf("%s: got target %s of type %s with standard %q", dir, app.Name, app.Type, app.Standard)
+		}
+		if want := []string{"C"}; !reflect.DeepEqual(app.Languages, want) {
+			t.Errorf("%s: got languages %q, want %q", dir, app.Languages, want)
+		}
+	}
+}
+
+func TestCMakeCodemodelConfiguration(t *testing.T) {
+	model, err := CMakeCodemodelByDirectory(cmakeFixture, "Debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if model.Configuration != "Debug" || len(model.TranslationUnits) != 1 {
+		t.Fatalf("got configuration %q with %d translation units", model.Configuration, len(model.TranslationUnits))
+	}
+	want := []string{"/usr/bin/g++", "-Dfoo_EXPORTS", "-I/src/foo/inc", "-g", "-std=gnu++17", "-c", "/src/foo/a.cpp"}
+	if got := model.TranslationUnits[0].Arguments; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if _, err := CMakeCodemodelByDirectory(cmakeFixture, "RelWithDebInfo"); err == nil {
+		t.Error("no error for a configuration that isn't in the reply")
+	}
+}
+
+func TestCMakeReplyDir(t *testing.T) {
+	replyDir := filepath.Join(cmakeFixture, cmakeReplyPath)
+	if got, ok := cmakeReplyDir(cmakeFixture); !ok || got != replyDir {
+		t.Errorf("build directory: got %q, %v", got, ok)
+	}
+	if got, ok := cmakeReplyDir(replyDir); !ok || got != replyDir {
+		t.Errorf("reply directory: got %q, %v", got, ok)
+	}
+	if _, ok := cmakeReplyDir("testdata"); ok {
+		t.Error("testdata taken for a build directory")
+	}
+}
@@ -0,0 +1,432 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+// This file contains the parsing of a single compiler call into a
+// CompileCommand, such that all extractors look at the same interpretation of
+// the command line rather than each doing their own prefix checks.
+
+package cc2ce
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// FlagCategory classifies a flag of a compiler call by its purpose.
+type FlagCategory int
+
+const (
+	FlagUnknown         FlagCategory = iota
+	FlagDefine                       // -D
+	FlagUndefine                     // -U
+	FlagInclude                      // -I, -isystem, --sysroot, ... (see IncludeDirsFromArgs)
+	FlagForcedInclude                // -include, -imacros
+	FlagStandard                     // -std=
+	FlagTarget                       // -m..., --target=, -arch
+	FlagOptimization                 // -O...
+	FlagWarning                      // -W..., -w, -pedantic
+	FlagDiagnostics                  // -Werror, -fdiagnostics-..., -fmessage-length=, ...
+	FlagCodegen                      // -f..., -pthread, --param
+	FlagDebug                        // -g..., -fdebug-prefix-map=, ...
+	FlagInstrumentation              // -fsanitize=, -fprofile-..., --coverage, ...
+	FlagOutput                       // -o, -c, -S, -E
+	FlagDependency                   // -M, -MD, -MF, ...
+	FlagLanguage                     // -x
+	FlagLinker                       // -l, -L, -Wl,..., -shared
+	FlagDriver                       // -pipe, -v, -save-temps
+	FlagInput                        // the source file
+)
+
+func (c FlagCategory) String() string {
+	switch c {
+	case FlagUnknown:
+		return "unknown"
+	case FlagDefine:
+		return "define"
+	case FlagUndefine:
+		return "undefine"
+	case FlagInclude:
+		return "include"
+	case FlagForcedInclude:
+		return "forced include"
+	case FlagStandard:
+		return "standard"
+	case FlagTarget:
+		return "target"
+	case FlagOptimization:
+		return "optimization"
+	case FlagWarning:
+		return "warning"
+	case FlagDiagnostics:
+		return "diagnostics"
+	case FlagCodegen:
+		return "codegen"
+	case FlagDebug:
+		return "debug"
+	case FlagInstrumentation:
+		return "instrumentation"
+	case FlagOutput:
+		return "output"
+	case FlagDependency:
+		return "dependency"
+	case FlagLanguage:
+		return "language"
+	case FlagLinker:
+		return "linker"
+	case FlagDriver:
+		return "driver"
+	case FlagInput:
+		return "input"
+	}
+	return fmt.Sprintf("FlagCategory(%d)", int(c))
+}
+
+// FlagCategoryByName returns the category whose String is name, where
+// dashes can be used instead of spaces (e.g. "forced-include").
+func FlagCategoryByName(name string) (FlagCategory, bool) {
+	name = strings.Replace(name, "-", " ", -1)
+	for c := FlagUnknown; c <= FlagInput; c++ {
+		if c.String() == name {
+			return c, true
+		}
+	}
+	return FlagUnknown, false
+}
+
+// Flag is one flag of a compiler call.
+//   - Args are the words as they were on the command line, e.g.
+//     ["-isystem", "/usr/include"] or ["-O2"]
+//   - Value is the argument of the flag, if it takes one, e.g.
+//     "/usr/include" or "2"
+type Flag struct {
+	Category FlagCategory
+	Args     []string
+	Value    string
+}
+
+// Define is a macro definition from a -D flag. HasValue distinguishes
+// -DFOO from -DFOO=.
+type Define struct {
+	Name     string
+	Value    string
+	HasValue bool
+}
+
+// CompileCommand is the interpretation of a single entry of a compilation
+// database. Flags holds everything after the compiler in command line order,
+// the other fields summarise the flags by category.
+type CompileCommand struct {
+	Directory string // working directory of the compiler call
+	File      string // input file as given in the database
+
+	Compiler  string   // the compiler as given, see CompilerPath
+	Launchers []string // launchers in front of the compiler, such as ccache
+	Wrappers  []string // other words in front of the compiler, kept to run it
+	Env       []string // VAR=value settings in front of the compiler
+	Flags     []Flag
+
+	Defines        []Define
+	Undefines      []string
+	IncludeDirs    []IncludeDir // as given on the command line, see IncludePaths
+	ForcedIncludes []string
+	Standard       string // e.g. "c++17"
+	Target         []string
+	Optimization   string // e.g. "2" for -O2, the last one given wins
+	Warnings       []string
+	Output         string
+	Dependency     []string
+	Language       string // from -x, empty if not given
+	Unknown        []string
+}
+
+// sourceExtensions are the file extensions treated as compiler input,
+// including headers (compiled into precompiled headers) and C++ module
+// interfaces.
+var sourceExtensions = map[string]bool{
+	".c": true, ".cc": true, ".cpp": true, ".cxx": true, ".c++": true, ".cp": true, ".C": true,
+	".cu": true, ".m": true, ".mm": true, ".s": true, ".S": true, ".sx": true,
+	".f": true, ".for": true, ".f77": true, ".f90": true, ".f95": true, ".f03": true, ".f08": true,
+	".F": true, ".F90": true, ".F95": true, ".F03": true, ".F08": true,
+	".h": true, ".hh": true, ".hpp": true, ".hxx": true, ".ipp": true,
+	".ixx": true, ".cppm": true, ".mpp": true,
+}
+
+func isSourceFile(word string) bool {
+	return sourceExtensions[filepath.Ext(word)]
+}
+
+// separatedArgumentFlags are flags that take their argument as next word
+// (some of them also joined), and their category.
+var separatedArgumentFlags = map[string]FlagCategory{
+	"-D":             FlagDefine,
+	"-U":             FlagUndefine,
+	"-o":             FlagOutput,
+	"-x":             FlagLanguage,
+	"-MF":            FlagDependency,
+	"-MT":            FlagDependency,
+	"-MQ":            FlagDependency,
+	"-target":        FlagTarget,
+	"-arch":          FlagTarget,
+	"--param":        FlagCodegen,
+	"-mllvm":         FlagCodegen,
+	"-Xlinker":       FlagLinker,
+	"-L":             FlagLinker,
+	"-l":             FlagLinker,
+	"-T":             FlagLinker,
+	"-u":             FlagLinker,
+	"-z":             FlagLinker,
+	"-Xclang":        FlagUnknown,
+	"-Xpreprocessor": FlagUnknown,
+	"-Xassembler":    FlagUnknown,
+	"-aux-info":      FlagUnknown,
+}
+
+// exactFlags are flags without argument which don't fit one of the prefix
+// rules in classifyFlag.
+var exactFlags = map[string]FlagCategory{
+	"-c":          FlagOutput,
+	"-S":          FlagOutput,
+	"-E":          FlagOutput,
+	"-M":          FlagDependency,
+	"-MM":         FlagDependency,
+	"-MD":         FlagDependency,
+	"-MMD":        FlagDependency,
+	"-MP":         FlagDependency,
+	"-MG":         FlagDependency,
+	"-w":          FlagWarning,
+	"-pthread":    FlagCodegen,
+	"-pipe":       FlagDriver,
+	"-v":          FlagDriver,
+	"-###":        FlagDriver,
+	"-shared":     FlagLinker,
+	"-static":     FlagLinker,
+	"-rdynamic":   FlagLinker,
+	"-nostdlib":   FlagLinker,
+	"-nostdinc":   FlagInclude,
+	"-nostdinc++": FlagInclude,
+
+	"-Werror":                  FlagDiagnostics,
+	"-Wfatal-errors":           FlagDiagnostics,
+	"-fcolor-diagnostics":      FlagDiagnostics,
+	"-fno-color-diagnostics":   FlagDiagnostics,
+	"-fansi-escape-codes":      FlagDiagnostics,
+	"-fcaret-diagnostics":      FlagDiagnostics,
+	"-fno-caret-diagnostics":   FlagDiagnostics,
+	"--coverage":               FlagInstrumentation,
+	"-coverage":                FlagInstrumentation,
+	"-ftest-coverage":          FlagInstrumentation,
+	"-fcoverage-mapping":       FlagInstrumentation,
+	"-fno-coverage-mapping":    FlagInstrumentation,
+	"-fstandalone-debug":       FlagDebug,
+	"-fno-standalone-debug":    FlagDebug,
+	"-fdebug-types-section":    FlagDebug,
+	"-fno-debug-types-section": FlagDebug,
+}
+
+// Prefixes of -W and -f flags which are not about warnings or code
+// generation.
+var (
+	diagnosticsPrefixes     = []string{"-Werror=", "-Wno-error", "-fdiagnostics-", "-fno-diagnostics-", "-fmessage-length=", "-fmax-errors=", "-ferror-limit="}
+	instrumentationPrefixes = []string{"-fsanitize", "-fno-sanitize", "-fprofile-", "-fno-profile-", "-finstrument-functions", "-fxray-"}
+	debugPrefixes           = []string{"-fdebug-", "-fno-eliminate-unused-debug-", "-ffile-prefix-map="}
+)
+
+func hasAnyPrefix(w string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(w, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// classifyFlag determines the category of a flag that takes no separate
+// argument, and the flag's value if it has a joined one.
+func classifyFlag(w string) (FlagCategory, string) {
+	if c, found := exactFlags[w]; found {
+		return c, ""
+	}
+	for _, prefix := range []string{"-D", "-U", "-o", "-x", "-MF", "-MT", "-MQ", "-L", "-l"} {
+		if strings.HasPrefix(w, prefix) {
+			return separatedArgumentFlags[prefix], w[len(prefix):]
+		}
+	}
+	switch {
+	case strings.HasPrefix(w, "-std="):
+		return FlagStandard, w[len("-std="):]
+	case strings.HasPrefix(w, "--std="):
+		return FlagStandard, w[len("--std="):]
+	case strings.HasPrefix(w, "-O"):
+		return FlagOptimization, w[len("-O"):]
+	case strings.HasPrefix(w, "-Wl,"):
+		return FlagLinker, w[len("-Wl,"):]
+	case strings.HasPrefix(w, "-Wa,"), strings.HasPrefix(w, "-Wp,"):
+		return FlagUnknown, w[len("-Wa,"):]
+	case hasAnyPrefix(w, diagnosticsPrefixes):
+		return FlagDiagnostics, ""
+	case hasAnyPrefix(w, instrumentationPrefixes):
+		return FlagInstrumentation, ""
+	case hasAnyPrefix(w, debugPrefixes):
+		return FlagDebug, ""
+	case strings.HasPrefix(w, "-W"), strings.HasPrefix(w, "-pedantic"):
+		return FlagWarning, ""
+	case strings.HasPrefix(w, "-f"):
+		return FlagCodegen, ""
+	case strings.HasPrefix(w, "-g"):
+		return FlagDebug, ""
+	case strings.HasPrefix(w, "-m"):
+		return FlagTarget, ""
+	case strings.HasPrefix(w, "--target="):
+		return FlagTarget, w[len("--target="):]
+	case strings.HasPrefix(w, "-save-temps"):
+		return FlagDriver, ""
+	}
+	return FlagUnknown, ""
+}
+
+// ParseCompileCommand interprets the compiler call of a translation unit.
+// The compiler is found as described for splitCompilerCall, e.g. g++ in
+// "ccache g++", "env FOO=1 g++" or "cd dir && g++". A cd changes the
+// Directory of the CompileCommand.
+func ParseCompileCommand(tu JsonTranslationunit) (CompileCommand, error) {
+	cc := CompileCommand{Directory: tu.Builddir, File: tu.File, Output: tu.Output}
+	argv, err := tu.Argv()
+	if err != nil {
+		return cc, err
+	}
+
+	prefix, err := splitCompilerCall(argv)
+	if err != nil {
+		return cc, err
+	}
+	if prefix.directory != "" {
+		if filepath.IsAbs(prefix.directory) {
+			cc.Directory = prefix.directory
+		} else {
+			cc.Directory = filepath.Join(cc.Directory, prefix.directory)
+		}
+	}
+	cc.Compiler = prefix.compiler
+	cc.Launchers = prefix.launchers
+	cc.Wrappers = prefix.wrappers
+	cc.Env = prefix.env
+
+	args := prefix.args
+	cc.IncludeDirs, err = IncludeDirsFromArgs(args)
+	if err != nil {
+		return cc, err
+	}
+
+	for i := 0; i < len(args); i++ {
+		w := args[i]
+		var flag Flag
+
+		if f, val, n, err := matchIncludeFlag(args, i); err != nil {
+			return cc, err
+		} else if n != 0 {
+			flag = Flag{Category: FlagInclude, Args: args[i : i+n], Value: val}
+			if f.action == ignoreIncludeOption {
+				flag.Category = FlagForcedInclude
+			}
+		} else if c, found := separatedArgumentFlags[w]; found {
+			if i+1 >= len(args) {
+				return cc, &DanglingArgumentError{Flag: w}
+			}
+			flag = Flag{Category: c, Args: args[i : i+2], Value: args[i+1]}
+		} else if !strings.HasPrefix(w, "-") {
+			flag = Flag{Category: FlagUnknown, Args: args[i : i+1], Value: w}
+			if w == tu.File || isSourceFile(w) {
+				flag.Category = FlagInput
+			}
+		} else {
+			c, val := classifyFlag(w)
+			flag = Flag{Category: c, Args: args[i : i+1], Value: val}
+		}
+		i += len(flag.Args) - 1
+
+		cc.Flags = append(cc.Flags, flag)
+		cc.summarise(flag)
+	}
+	return cc, nil
+}
+
+// summarise fills the per-category fields of the CompileCommand.
+func (cc *CompileCommand) summarise(flag Flag) {
+	switch flag.Category {
+	case FlagDefine:
+		d := Define{Name: flag.Value}
+		if eq := strings.Index(flag.Value, "="); eq >= 0 {
+			d = Define{Name: flag.Value[:eq], Value: flag.Value[eq+1:], HasValue: true}
+		}
+		cc.Defines = append(cc.Defines, d)
+	case FlagUndefine:
+		cc.Undefines = append(cc.Undefines, flag.Value)
+	case FlagForcedInclude:
+		if flag.Args[0] != "-include-pch" {
+			cc.ForcedIncludes = append(cc.ForcedIncludes, flag.Value)
+		}
+	case FlagStandard:
+		cc.Standard = flag.Value
+	case FlagTarget:
+		cc.Target = append(cc.Target, flag.Args...)
+	case FlagOptimization:
+		cc.Optimization = flag.Value
+	case FlagWarning:
+		cc.Warnings = append(cc.Warnings, flag.Args...)
+	case FlagOutput:
+		if strings.HasPrefix(flag.Args[0], "-o") {
+			cc.Output = flag.Value
+		}
+	case FlagDependency:
+		cc.Dependency = append(cc.Dependency, flag.Args...)
+	case FlagLanguage:
+		cc.Language = flag.Value
+	case FlagUnknown:
+		cc.Unknown = append(cc.Unknown, flag.Args...)
+	}
+}
+
+// IncludePaths returns the include paths of the compiler call, see
+// IncludeDirsFromArgs. When turnAbsolute is true, relative paths are taken
+// relative to the working directory of the compiler call.
+func (cc CompileCommand) IncludePaths(turnAbsolute bool) []IncludeDir {
+	dirs := make([]IncludeDir, len(cc.IncludeDirs))
+	copy(dirs, cc.IncludeDirs)
+	if turnAbsolute {
+		for i := range dirs {
+			if !filepath.IsAbs(dirs[i].Path) {
+				dirs[i].Path = filepath.Join(cc.Directory, dirs[i].Path)
+			}
+		}
+	}
+	return dirs
+}
+
+// CompilerCall returns the compiler together with its wrappers (but without
+// launchers and environment settings) as single string.
+func (cc CompileCommand) CompilerCall() string {
+	return JoinArguments(append(append([]string{}, cc.Wrappers...), cc.Compiler))
+}
+
+// CompileCommandsFromDB parses all translation units of a database.
+func CompileCommandsFromDB(db []JsonTranslationunit) ([]CompileCommand, error) {
+	cmds := make([]CompileCommand, 0, len(db))
+	for _, tu := range db {
+		cc, err := ParseCompileCommand(tu)
+		if err != nil {
+			return cmds, fmt.Errorf("%s: %w", tu.File, err)
+		}
+		cmds = append(cmds, cc)
+	}
+	return cmds, nil
+}
@@ -0,0 +1,173 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+package cc2ce
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// parseFlags parses a g++ call of a.cpp with the given flags in front of
+// -c a.cpp and returns the parsed command.
+func parseFlags(flags ...string) (CompileCommand, error) {
+	args := append(append([]string{"g++"}, flags...), "-c", "a.cpp")
+	return ParseCompileCommand(JsonTranslationunit{Builddir: "/b", File: "a.cpp", Arguments: args})
+}
+
+func TestParseCompileCommandTables(t *testing.T) {
+	for w, c := range separatedArgumentFlags {
+		cc, err := parseFlags(w, "arg")
+		if err != nil {
+			t.Errorf("%s arg: %v", w, err)
+			continue
+		}
+		want := Flag{Category: c, Args: []string{w, "arg"}, Value: "arg"}
+		if !reflect.DeepEqual(cc.Flags[0], want) {
+			t.Errorf("%s arg: got %+v, want %+v", w, cc.Flags[0], want)
+		}
+		if _, err := ParseCompileCommand(JsonTranslationunit{Builddir: "/b", File: "a.cpp", Arguments: []string{"g++", "-c", "a.cpp", w}}); !errors.As(err, new(*DanglingArgumentError)) {
+			t.Errorf("%s at the end: got error %v, want a dangling argument", w, err)
+		}
+	}
+	for w, c := range exactFlags {
+		cc, err := parseFlags(w)
+		if err != nil {
+			t.Errorf("%s: %v", w, err)
+			continue
+		}
+		want := Flag{Category: c, Args: []string{w}}
+		if !reflect.DeepEqual(cc.Flags[0], want) {
+			t.Errorf("%s: got %+v, want %+v", w, cc.Flags[0], want)
+		}
+	}
+}
+
+func TestParseCompileCommandFlags(t *testing.T) {
+	tests := []struct {
+		args []string
+		want Flag
+	}{
+		{[]string{"-mllvm", "-inline-threshold=100"}, Flag{FlagCodegen, []string{"-mllvm", "-inline-threshold=100"}, "-inline-threshold=100"}},
+		{[]string{"-Xclang", "-fno-pch-timestamp"}, Flag{FlagUnknown, []string{"-Xclang", "-fno-pch-timestamp"}, "-fno-pch-timestamp"}},
+		{[]string{"-include", "config.h"}, Flag{FlagForcedInclude, []string{"-include", "config.h"}, "config.h"}},
+		{[]string{"-includeconfig.h"}, Flag{FlagForcedInclude, []string{"-includeconfig.h"}, "config.h"}},
+		{[]string{"-include-pch", "all.pch"}, Flag{FlagForcedInclude, []string{"-include-pch", "all.pch"}, "all.pch"}},
+		{[]string{"-imacros", "macros.h"}, Flag{FlagForcedInclude, []string{"-imacros", "macros.h"}, "macros.h"}},
+		{[]string{"-U", "NDEBUG"}, Flag{FlagUndefine, []string{"-U", "NDEBUG"}, "NDEBUG"}},
+		{[]string{"-UNDEBUG"}, Flag{FlagUndefine, []string{"-UNDEBUG"}, "NDEBUG"}},
+		{[]string{"-D", "X=1"}, Flag{FlagDefine, []string{"-D", "X=1"}, "X=1"}},
+		{[]string{"-DX=1"}, Flag{FlagDefine, []string{"-DX=1"}, "X=1"}},
+		{[]string{"-isystem", "/usr/include"}, Flag{FlagInclude, []string{"-isystem", "/usr/include"}, "/usr/include"}},
+		{[]string{"-I/inc"}, Flag{FlagInclude, []string{"-I/inc"}, "/inc"}},
+		{[]string{"-o", "a.o"}, Flag{FlagOutput, []string{"-o", "a.o"}, "a.o"}},
+		{[]string{"-oa.o"}, Flag{FlagOutput, []string{"-oa.o"}, "a.o"}},
+		{[]string{"-xc++"}, Flag{FlagLanguage, []string{"-xc++"}, "c++"}},
+		{[]string{"-MFa.d"}, Flag{FlagDependency, []string{"-MFa.d"}, "a.d"}},
+		{[]string{"-lfoo"}, Flag{FlagLinker, []string{"-lfoo"}, "foo"}},
+		{[]string{"-march=native"}, Flag{FlagTarget, []string{"-march=native"}, ""}},
+		{[]string{"--target=aarch64-linux-gnu"}, Flag{FlagTarget, []string{"--target=aarch64-linux-gnu"}, "aarch64-linux-gnu"}},
+		{[]string{"-Wl,-rpath,/lib"}, Flag{FlagLinker, []string{"-Wl,-rpath,/lib"}, "-rpath,/lib"}},
+		{[]string{"b.hpp"}, Flag{FlagInput, []string{"b.hpp"}, "b.hpp"}},
+	}
+	for _, tt := range tests {
+		cc, err := parseFlags(tt.args...)
+		if err != nil {
+			t.Errorf("%q: %v", tt.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(cc.Flags[0], tt.want) {
+			t.Errorf("%q: got %+v, want %+v", tt.args, cc.Flags[0], tt.want)
+		}
+	}
+}
+
+func TestParseCompileCommandSummary(t *testing.T) {
+	cc, err := parseFlags(
+		"-mllvm", "-enable-misched", "-Xclang", "-ast-dump", "-include", "config.h", "-include-pch", "all.pch",
+		"-U", "NDEBUG", "-UDEBUG", "-DX=1", "-DY", "-DZ=", "-std=c++17", "-O3", "-O2", "-m64", "-target", "x86_64",
+		"-Wall", "-w", "-MD", "-MF", "a.d", "-x", "c++", "-o", "a.o")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := CompileCommand{
+		Defines:        cc.Defines,
+		Undefines:      cc.Undefines,
+		ForcedIncludes: cc.ForcedIncludes,
+		Standard:       cc.Standard,
+		Target:         cc.Target,
+		Optimization:   cc.Optimization,
+		Warnings:       cc.Warnings,
+		Output:         cc.Output,
+		Dependency:     cc.Dependency,
+		Language:       cc.Language,
+		Unknown:        cc.Unknown,
+	}
+	want := CompileCommand{
+		Defines:        []Define{{Name: "X", Value: "1", HasValue: true}, {Name: "Y"}, {Name: "Z", HasValue: true}},
+		Undefines:      []string{"NDEBUG", "DEBUG"},
+		ForcedIncludes: []string{"config.h"},
+		Standard:       "c++17",
+		Target:         []string{"-m64", "-target", "x86_64"},
+		Optimization:   "2",
+		Warnings:       []string{"-Wall", "-w"},
+		Output:         "a.o",
+		Dependency:     []string{"-MD", "-MF", "a.d"},
+		Language:       "c++",
+		Unknown:        []string{"-Xclang", "-ast-dump"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestClassifyFlag(t *testing.T) {
+	tests := []struct {
+		flag     string
+		category FlagCategory
+		value    string
+	}{
+		{"-c", FlagOutput, ""},
+		{"-pthread", FlagCodegen, ""},
+		{"-shared", FlagLinker, ""},
+		{"-nostdinc++", FlagInclude, ""},
+		{"-Werror", FlagDiagnostics, ""},
+		{"-Werror=format", FlagDiagnostics, ""},
+		{"-fdiagnostics-color=always", FlagDiagnostics, ""},
+		{"-fsanitize=address", FlagInstrumentation, ""},
+		{"--coverage", FlagInstrumentation, ""},
+		{"-fdebug-prefix-map=/a=/b", FlagDebug, ""},
+		{"-fstandalone-debug", FlagDebug, ""},
+		{"-g3", FlagDebug, ""},
+		{"-Wall", FlagWarning, ""},
+		{"-pedantic-errors", FlagWarning, ""},
+		{"-fPIC", FlagCodegen, ""},
+		{"-m64", FlagTarget, ""},
+		{"-std=gnu++20", FlagStandard, "gnu++20"},
+		{"--std=c11", FlagStandard, "c11"},
+		{"-Os", FlagOptimization, "s"},
+		{"-DX=1", FlagDefine, "X=1"},
+		{"-UX", FlagUndefine, "X"},
+		{"-L/lib", FlagLinker, "/lib"},
+		{"-MTa.o", FlagDependency, "a.o"},
+		{"-Wa,--noexecstack", FlagUnknown, "--noexecstack"},
+		{"-Wp,-MD,a.d", FlagUnknown, "-MD,a.d"},
+		{"-save-temps=obj", FlagDriver, ""},
+		{"--frobnicate", FlagUnknown, ""},
+	}
+	for _, tt := range tests {
+		if category, value := classifyFlag(tt.flag); category != tt.category || value != tt.value {
+			t.Errorf("%s: got %s %q, want %s %q", tt.flag, category, value, tt.category, tt.value)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+// This file contains the translation of compiler options between compilers,
+// such that the options of one build can be used with other compilers (e.g.
+// the options of a gcc 7 nightly on clang 6, which doesn't know
+// -Wsuggest-override, or on gcc 6, which doesn't know -std=c++17).
+
+package cc2ce
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CompatRule is an entry of the compatibility table: compilers of Family
+// (as in CompilerInfo) with a version before Before (all versions if empty)
+// don't understand Flag and get Replacement instead, or nothing if
+// Replacement is empty. A Flag ending in = matches all values of the flag,
+// which are then appended to Replacement.
+type CompatRule struct {
+	Family      string
+	Before      string
+	Flag        string
+	Replacement string
+}
+
+// CompatTable is the maintained table of flags that need translation. Only
+// the first matching rule is applied, so older versions come first.
+var CompatTable = []CompatRule{
+	// language standards, under their names before publication
+	{Family: "gcc", Before: "4.9", Flag: "-std=c++14", Replacement: "-std=c++1y"},
+	{Family: "gcc", Before: "4.9", Flag: "-std=gnu++14", Replacement: "-std=gnu++1y"},
+	{Family: "gcc", Before: "5", Flag: "-std=c++17"},
+	{Family: "gcc", Before: "5", Flag: "-std=gnu++17"},
+	{Family: "gcc", Before: "7", Flag: "-std=c++17", Replacement: "-std=c++1z"},
+	{Family: "gcc", Before: "7", Flag: "-std=gnu++17", Replacement: "-std=gnu++1z"},
+	{Family: "gcc", Before: "8", Flag: "-std=c++20"},
+	{Family: "gcc", Before: "8", Flag: "-std=gnu++20"},
+	{Family: "gcc", Before: "10", Flag: "-std=c++20", Replacement: "-std=c++2a"},
+	{Family: "gcc", Before: "10", Flag: "-std=gnu++20", Replacement: "-std=gnu++2a"},
+	{Family: "gcc", Before: "11", Flag: "-std=c++23", Replacement: "-std=c++2b"},
+	{Family: "gcc", Before: "11", Flag: "-std=gnu++23", Replacement: "-std=gnu++2b"},
+	{Family: "clang", Before: "3.5", Flag: "-std=c++14", Replacement: "-std=c++1y"},
+	{Family: "clang", Before: "3.5", Flag: "-std=gnu++14", Replacement: "-std=gnu++1y"},
+	{Family: "clang", Before: "5", Flag: "-std=c++17", Replacement: "-std=c++1z"},
+	{Family: "clang", Before: "5", Flag: "-std=gnu++17", Replacement: "-std=gnu++1z"},
+	{Family: "clang", Before: "10", Flag: "-std=c++20", Replacement: "-std=c++2a"},
+	{Family: "clang", Before: "10", Flag: "-std=gnu++20", Replacement: "-std=gnu++2a"},
+	{Family: "clang", Before: "17", Flag: "-std=c++23", Replacement: "-std=c++2b"},
+	{Family: "clang", Before: "17", Flag: "-std=gnu++23", Replacement: "-std=gnu++2b"},
+
+	// warnings of gcc which clang doesn't have (or only got later)
+	{Family: "clang", Before: "11", Flag: "-Wsuggest-override"},
+	{Family: "clang", Flag: "-Wlogical-op"},
+	{Family: "clang", Flag: "-Wduplicated-cond"},
+	{Family: "clang", Flag: "-Wduplicated-branches"},
+	{Family: "clang", Flag: "-Wuseless-cast"},
+	{Family: "clang", Flag: "-Wnoexcept"},
+	{Family: "clang", Flag: "-Wstrict-null-sentinel"},
+	{Family: "clang", Flag: "-Wno-maybe-uninitialized"},
+	{Family: "gcc", Before: "5", Flag: "-Wsuggest-override"},
+
+	// warnings of clang which gcc doesn't have
+	{Family: "gcc", Flag: "-Weverything"},
+	{Family: "gcc", Flag: "-Wdocumentation"},
+	{Family: "gcc", Flag: "-Wshorten-64-to-32"},
+	{Family: "gcc", Flag: "-Wthread-safety"},
+	{Family: "gcc", Flag: "-Wno-unknown-warning-option"},
+
+	// diagnostics and code generation flags under other names
+	{Family: "clang", Flag: "-fmax-errors=", Replacement: "-ferror-limit="},
+	{Family: "clang", Flag: "-fno-var-tracking-assignments"},
+	{Family: "clang", Flag: "-fconcepts"},
+	{Family: "gcc", Flag: "-ferror-limit=", Replacement: "-fmax-errors="},
+	{Family: "gcc", Flag: "-fcolor-diagnostics", Replacement: "-fdiagnostics-color"},
+	{Family: "gcc", Flag: "-fno-color-diagnostics", Replacement: "-fno-diagnostics-color"},
+}
+
+// OptionAdjustment is a change TranslateOptions made, Replacement is empty
+// for dropped flags.
+type OptionAdjustment struct {
+	Flag        string
+	Replacement string
+}
+
+func (a OptionAdjustment) String() string {
+	if a.Replacement == "" {
+		return "dropped " + a.Flag
+	}
+	return "replaced " + a.Flag + " by " + a.Replacement
+}
+
+// versionBefore tells if version a is before version b, comparing the
+// numeric components (e.g. "4.8.5" is before "4.9"). A version a which
+// doesn't start with a number (empty or unparseable) is before nothing.
+func versionBefore(a, b string) bool {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+	if leadingDigits(as[0]) == "" {
+		return false
+	}
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(leadingDigits(as[i]))
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(leadingDigits(bs[i]))
+		}
+		if x != y {
+			return x < y
+		}
+	}
+	return false
+}
+
+func leadingDigits(s string) string {
+	end := 0
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	return s[:end]
+}
+
+// splitOptionWords splits an options string at whitespace outside quotes,
+// keeping the words as they are written (with their quotes). Runs of
+// whitespace separate like a single space, there are no empty words.
+func splitOptionWords(options string) []string {
+	var words []string
+	start := 0
+	var quote byte
+	for i := 0; i < len(options); i++ {
+		c := options[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '\\':
+			i++
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ' ' || c == '\t' || c == '\n':
+			if i > start {
+				words = append(words, options[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if start < len(options) {
+		words = append(words, options[start:])
+	}
+	return words
+}
+
+// compatRule returns the rule of CompatTable for a flag, or nil. Unknown
+// (empty or unparseable) versions are taken to be recent, only rules for
+// all versions apply then.
+func compatRule(word, family, version string) *CompatRule {
+	for i := range CompatTable {
+		r := &CompatTable[i]
+		if r.Family != family {
+			continue
+		}
+		if r.Before != "" && !versionBefore(version, r.Before) {
+			continue
+		}
+		if word == r.Flag || (strings.HasSuffix(r.Flag, "=") && strings.HasPrefix(word, r.Flag)) {
+			return r
+		}
+	}
+	return nil
+}
+
+// TranslateOptions adapts compiler options (as from OptionsFromCommands)
+// to a compiler of the given family and version, see CompatTable, and
+// returns the adjustments it made.
+func TranslateOptions(options string, family, version string) (string, []OptionAdjustment) {
+	if options == "" {
+		return options, nil
+	}
+	var words []string
+	var adjustments []OptionAdjustment
+	for _, w := range splitOptionWords(options) {
+		r := compatRule(w, family, version)
+		if r == nil {
+			words = append(words, w)
+			continue
+		}
+		replacement := r.Replacement
+		if replacement != "" && strings.HasSuffix(r.Flag, "=") {
+			replacement += w[len(r.Flag):]
+		}
+		adjustments = append(adjustments, OptionAdjustment{Flag: w, Replacement: replacement})
+		if replacement != "" {
+			words = append(words, replacement)
+		}
+	}
+	return strings.Join(words, " "), adjustments
+}
@@ -0,0 +1,154 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+package cc2ce
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVersionBefore(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"4.8.5", "4.9", true},
+		{"4.9", "4.9", false},
+		{"4.9.0", "4.9", false},
+		{"4.10", "4.9", false},
+		{"6", "7", true},
+		{"7.0.1", "7", false},
+		{"12.3.0", "10", false},
+		{"9.4.0-1ubuntu1", "10", true},
+		{"10.0.0git", "10", false},
+		{"3.4svn", "3.5", true},
+		// unknown versions are before nothing
+		{"", "5", false},
+		{"x", "5", false},
+		{"x.1", "5", false},
+		{"trunk", "100", false},
+	}
+	for _, tt := range tests {
+		if got := versionBefore(tt.a, tt.b); got != tt.want {
+			t.Errorf("%q before %q: got %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSplitOptionWords(t *testing.T) {
+	tests := []struct {
+		options string
+		want    []string
+	}{
+		{"", nil},
+		{"-O2", []string{"-O2"}},
+		{"-std=c++17 -O2", []string{"-std=c++17", "-O2"}},
+		{"  -std=c++17   -O2  ", []string{"-std=c++17", "-O2"}},
+		{"-std=c++17\t-O2\n-g", []string{"-std=c++17", "-O2", "-g"}},
+		{`-DX="a b" -O2`, []string{`-DX="a b"`, "-O2"}},
+		{`-DX='a  b' -DY="c\" d"`, []string{`-DX='a  b'`, `-DY="c\" d"`}},
+		{`-DX=a\ b -O2`, []string{`-DX=a\ b`, "-O2"}},
+	}
+	for _, tt := range tests {
+		if got := splitOptionWords(tt.options); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.options, got, tt.want)
+		}
+	}
+}
+
+func TestTranslateOptionsForCompilers(t *testing.T) {
+	tests := []struct {
+		options     string
+		family      string
+		version     string
+		want        string
+		adjustments []OptionAdjustment
+	}{
+		{
+			options: "-std=c++17 -O2",
+			family:  "gcc", version: "12.3.0",
+			want: "-std=c++17 -O2",
+		},
+		{
+			options: "-std=c++17 -O2",
+			family:  "gcc", version: "6.4.0",
+			want:        "-std=c++1z -O2",
+			adjustments: []OptionAdjustment{{Flag: "-std=c++17", Replacement: "-std=c++1z"}},
+		},
+		{
+			// the first matching rule wins, older versions come first
+			options: "-std=c++17 -O2",
+			family:  "gcc", version: "4.9.4",
+			want:        "-O2",
+			adjustments: []OptionAdjustment{{Flag: "-std=c++17"}},
+		},
+		{
+			// no double spaces where flags are dropped
+			options: "-std=c++17 -Wlogical-op -O2 -Wuseless-cast",
+			family:  "clang", version: "15.0.7",
+			want:        "-std=c++17 -O2",
+			adjustments: []OptionAdjustment{{Flag: "-Wlogical-op"}, {Flag: "-Wuseless-cast"}},
+		},
+		{
+			options: "-Wlogical-op",
+			family:  "clang", version: "15.0.7",
+			want:        "",
+			adjustments: []OptionAdjustment{{Flag: "-Wlogical-op"}},
+		},
+		{
+			options: "-Wsuggest-override -Wall",
+			family:  "clang", version: "6.0.1",
+			want:        "-Wall",
+			adjustments: []OptionAdjustment{{Flag: "-Wsuggest-override"}},
+		},
+		{
+			// flags with values
+			options: "-fmax-errors=5 -DX=\"a b\"",
+			family:  "clang", version: "15.0.7",
+			want:        "-ferror-limit=5 -DX=\"a b\"",
+			adjustments: []OptionAdjustment{{Flag: "-fmax-errors=5", Replacement: "-ferror-limit=5"}},
+		},
+		{
+			// unknown and unparseable versions are recent
+			options: "-std=c++20 -Weverything",
+			family:  "gcc", version: "",
+			want:        "-std=c++20",
+			adjustments: []OptionAdjustment{{Flag: "-Weverything"}},
+		},
+		{
+			options: "-std=c++20 -Weverything",
+			family:  "gcc", version: "x",
+			want:        "-std=c++20",
+			adjustments: []OptionAdjustment{{Flag: "-Weverything"}},
+		},
+		{
+			options: "-std=c++20 -Wlogical-op",
+			family:  "icc", version: "2021.10.0",
+			want: "-std=c++20 -Wlogical-op",
+		},
+		{
+			options: "",
+			family:  "clang", version: "15",
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		got, adjustments := TranslateOptions(tt.options, tt.family, tt.version)
+		if got != tt.want {
+			t.Errorf("%q for %s %s: got %q, want %q", tt.options, tt.family, tt.version, got, tt.want)
+		}
+		if !reflect.DeepEqual(adjustments, tt.adjustments) {
+			t.Errorf("%q for %s %s: got adjustments %v, want %v", tt.options, tt.family, tt.version, adjustments, tt.adjustments)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+// This file contains the reading of clangd's compile_flags.txt, which
+// header-only packages sometimes ship instead of a compilation database. It
+// is treated as a database with a single translation unit.
+
+package cc2ce
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CompileFlagsCompiler is the compiler assumed for the flags in a
+// compile_flags.txt (which doesn't name one).
+var CompileFlagsCompiler = "clang++"
+
+const compileFlagsName = "compile_flags.txt"
+
+// CompileFlagsTUsByBytes turns the content of a compile_flags.txt (one flag
+// per line) into a database with a single translation unit, compiled in
+// dir. Relative paths in the flags are relative to dir, as for clangd.
+func CompileFlagsTUsByBytes(inFileContent []byte, dir string) ([]JsonTranslationunit, error) {
+	tu := JsonTranslationunit{
+		Builddir:  dir,
+		File:      filepath.Join(dir, compileFlagsName),
+		Arguments: []string{CompileFlagsCompiler},
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(inFileContent))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		tu.Arguments = append(tu.Arguments, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return []JsonTranslationunit{tu}, nil
+}
+
+// CompileFlagsTUsByFilename reads a compile_flags.txt, see
+// CompileFlagsTUsByBytes. The flags are taken relative to the directory of
+// the file.
+func CompileFlagsTUsByFilename(inFileName string) ([]JsonTranslationunit, error) {
+	content, err := ioutil.ReadFile(inFileName)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := filepath.Abs(filepath.Dir(inFileName))
+	if err != nil {
+		return nil, err
+	}
+	return CompileFlagsTUsByBytes(content, dir)
+}
+
+// compileFlagsFilename tells if inFileName refers to a compile_flags.txt:
+// either directly, or as a directory that contains a compile_flags.txt but
+// no compile_commands.json.
+func compileFlagsFilename(inFileName string) (string, bool) {
+	if filepath.Base(inFileName) == compileFlagsName {
+		return inFileName, true
+	}
+	info, err := os.Stat(inFileName)
+	if err != nil || !info.IsDir() {
+		return "", false
+	}
+	for _, n := range databaseNames {
+		if _, err := os.Stat(filepath.Join(inFileName, n)); err == nil {
+			return "", false
+		}
+	}
+	candidate := filepath.Join(inFileName, compileFlagsName)
+	if _, err := os.Stat(candidate); err != nil {
+		return "", false
+	}
+	return candidate, true
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+package cc2ce
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCompileFlagsTUsByBytes(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "one flag per line",
+			content: "-std=c++17\n-Iinclude\n-DNAME=a b\n",
+			want:    []string{"clang++", "-std=c++17", "-Iinclude", "-DNAME=a b"},
+		},
+		{
+			name:    "blank lines",
+			content: "\n-O2\n\n\n-Wall\n",
+			want:    []string{"clang++", "-O2", "-Wall"},
+		},
+		{
+			name:    "windows line endings and no final newline",
+			content: "-O2\r\n-Wall\r\n-g",
+			want:    []string{"clang++", "-O2", "-Wall", "-g"},
+		},
+		{
+			name:    "separated argument",
+			content: "-isystem\n../third_party\n-xc++\n",
+			want:    []string{"clang++", "-isystem", "../third_party", "-xc++"},
+		},
+		{
+			name:    "empty",
+			content: "",
+			want:    []string{"clang++"},
+		},
+	}
+	for _, tt := range tests {
+		db, err := CompileFlagsTUsByBytes([]byte(tt.content), "/src/pkg")
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(db) != 1 {
+			t.Errorf("%s: got %d translation units", tt.name, len(db))
+			continue
+		}
+		if db[0].Builddir != "/src/pkg" || db[0].File != "/src/pkg/compile_flags.txt" {
+			t.Errorf("%s: got directory %q and file %q", tt.name, db[0].Builddir, db[0].File)
+		}
+		if !reflect.DeepEqual(db[0].Arguments, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, db[0].Arguments, tt.want)
+		}
+	}
+}
+
+func TestCompileFlagsTUsByFilename(t *testing.T) {
+	dir := t.TempDir()
+	pkg := filepath.Join(dir, "pkg")
+	if err := os.Mkdir(pkg, 0755); err != nil {
+		t.Fatal(err)
+	}
+	flags := "-std=c++17\n\n-Iinclude\n-I/abs/include\n-isystem\n../third_party\n-iquote.\n"
+	if err := ioutil.WriteFile(filepath.Join(pkg, compileFlagsName), []byte(flags), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the file itself, or the directory containing it, also when given
+	// relative to the working directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{filepath.Join(pkg, compileFlagsName), pkg, filepath.Join("pkg", compileFlagsName), "pkg"} {
+		db, err := JsonTUsByFilename(name)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if len(db) != 1 || db[0].Builddir != pkg {
+			t.Errorf("%s: got %+v", name, db)
+			continue
+		}
+		cc, err := ParseCompileCommand(db[0])
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		var got []string
+		for _, d := range cc.IncludePaths(true) {
+			got = append(got, d.Path)
+		}
+		want := []string{filepath.Join(pkg, "include"), "/abs/include", filepath.Join(dir, "third_party"), pkg}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got include paths %q, want %q", name, got, want)
+		}
+		if cc.Standard != "c++17" {
+			t.Errorf("%s: got standard %q", name, cc.Standard)
+		}
+	}
+
+	// a compilation database next to it is preferred
+	if err := ioutil.WriteFile(filepath.Join(pkg, "compile_commands.json"), []byte(openTestDatabase), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if db, err := JsonTUsByFilename(pkg); err != nil || len(db) != 1 || db[0].File != "a.cpp" {
+		t.Errorf("with compile_commands.json: got %+v, %v", db, err)
+	}
+	if _, err := CompileFlagsTUsByFilename(filepath.Join(dir, "missing", compileFlagsName)); !os.IsNotExist(err) {
+		t.Errorf("got error %v for a missing file", err)
+	}
+}
@@ -0,0 +1,289 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+// This file contains the detection of the compiler in a compiler call, which
+// is often hidden behind launchers (ccache g++), environment settings
+// (env FOO=1 clang++) or shell commands (cd dir && g++).
+
+package cc2ce
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CompilerLaunchers are programs that run the compiler given to them as
+// first argument and are not needed to compile in Compiler Explorer. They
+// are also recognised when a compiler is a symlink to them (such as
+// /usr/lib/ccache/g++).
+var CompilerLaunchers = map[string]bool{
+	"ccache":     true,
+	"sccache":    true,
+	"distcc":     true,
+	"icecc":      true,
+	"buildcache": true,
+}
+
+// envArgumentOptions are the options of env(1) which take an argument.
+var envArgumentOptions = map[string]bool{
+	"-u":      true,
+	"--unset": true,
+	"-C":      true,
+	"--chdir": true,
+	"-S":      true,
+}
+
+// compilerPrefix is what comes before the flags of a compiler call.
+//   - directory is the directory changed to with cd or env -C (relative to
+//     the working directory of the call), empty if none
+//   - env are VAR=value settings for the compiler
+//   - launchers are the words of the known launchers, see CompilerLaunchers
+//   - wrappers are unknown words between the launchers and the compiler,
+//     which are kept as they might be needed to run the compiler
+//   - args are the words after the compiler
+type compilerPrefix struct {
+	directory string
+	env       []string
+	launchers []string
+	wrappers  []string
+	compiler  string
+	args      []string
+}
+
+// isEnvAssignment tells if a word is a VAR=value setting.
+func isEnvAssignment(w string) bool {
+	eq := strings.Index(w, "=")
+	if eq <= 0 {
+		return false
+	}
+	for i, r := range w[:eq] {
+		if !(r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (i > 0 && r >= '0' && r <= '9')) {
+			return false
+		}
+	}
+	return true
+}
+
+// chdir applies a cd to the directory of the prefix.
+func (p *compilerPrefix) chdir(dir string) {
+	if filepath.IsAbs(dir) || p.directory == "" {
+		p.directory = dir
+	} else {
+		p.directory = filepath.Join(p.directory, dir)
+	}
+}
+
+// splitCompilerCall finds the compiler in a compiler call. Commands chained
+// with && or ; are split, of which the first one that isn't a cd is taken
+// as compiler call (a cd changes the directory). In the compiler call,
+// leading VAR=value settings, env(1) with its options, and launchers are
+// skipped. Of the remaining words before the first flag (including
+// @response files) or source file, the last one is the compiler.
+func splitCompilerCall(args []string) (compilerPrefix, error) {
+	var p compilerPrefix
+
+	var call []string
+	for start := 0; start < len(args) && call == nil; {
+		end := start
+		for end < len(args) && args[end] != "&&" && args[end] != ";" {
+			end++
+		}
+		command := args[start:end]
+		if len(command) != 0 && command[0] == "cd" {
+			if len(command) > 1 {
+				p.chdir(command[1])
+			}
+		} else if len(command) != 0 {
+			call = command
+		}
+		start = end + 1
+	}
+
+	i := 0
+	for i < len(call) {
+		w := call[i]
+		switch {
+		case isEnvAssignment(w):
+			p.env = append(p.env, w)
+			i++
+		case filepath.Base(w) == "env":
+			for i++; i < len(call) && strings.HasPrefix(call[i], "-"); i++ {
+				option := call[i]
+				value := ""
+				if eq := strings.Index(option, "="); eq >= 0 && strings.HasPrefix(option, "--") {
+					option, value = option[:eq], option[eq+1:]
+				} else if envArgumentOptions[option] && i+1 < len(call) {
+					i++
+					value = call[i]
+				}
+				if option == "-C" || option == "--chdir" {
+					p.chdir(value)
+				}
+				if option == "--" {
+					i++
+					break
+				}
+			}
+		case CompilerLaunchers[filepath.Base(w)]:
+			p.launchers = append(p.launchers, w)
+			i++
+			if i < len(call) && call[i] == "--" {
+				i++
+			}
+		default:
+			j := i
+			for ; j < len(call); j++ {
+				if strings.HasPrefix(call[j], "-") || strings.HasPrefix(call[j], "@") || isSourceFile(call[j]) {
+					break
+				}
+			}
+			if j == i {
+				return p, fmt.Errorf("no compiler found in compiler call")
+			}
+			p.compiler = call[j-1]
+			p.wrappers = call[i : j-1]
+			p.args = call[j:]
+			return p, nil
+		}
+	}
+	return p, fmt.Errorf("no compiler found in compiler call")
+}
+
+// isLauncher tells if an executable is a launcher, also when it
+// masquerades as compiler through a symlink.
+func isLauncher(path string) bool {
+	if CompilerLaunchers[filepath.Base(path)] {
+		return true
+	}
+	target, err := filepath.EvalSymlinks(path)
+	return err == nil && CompilerLaunchers[filepath.Base(target)]
+}
+
+// isExecutable tells if path is an executable file.
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular() && info.Mode().Perm()&0111 != 0
+}
+
+// CompilerPath resolves the compiler of a compiler call to the executable
+// that gets run: a compiler without directory is looked up in the PATH (as
+// set in Env, or of this process), a relative one is taken relative to the
+// working directory. Launchers that masquerade as compiler (such as
+// /usr/lib/ccache/g++, a symlink to ccache) are skipped in favour of the
+// next compiler of that name in the PATH.
+func (cc CompileCommand) CompilerPath() (string, error) {
+	searchPath := os.Getenv("PATH")
+	for _, e := range cc.Env {
+		if strings.HasPrefix(e, "PATH=") {
+			searchPath = e[len("PATH="):]
+		}
+	}
+
+	var candidates []string
+	name := cc.Compiler
+	if strings.Contains(name, "/") {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(cc.Directory, name)
+		}
+		candidates = append(candidates, name)
+		name = filepath.Base(name)
+	}
+	for _, dir := range filepath.SplitList(searchPath) {
+		if dir == "" {
+			dir = "."
+		}
+		candidates = append(candidates, filepath.Join(dir, name))
+	}
+
+	for _, c := range candidates {
+		if !isExecutable(c) || isLauncher(c) {
+			continue
+		}
+		if abs, err := filepath.Abs(c); err == nil {
+			c = abs
+		}
+		return c, nil
+	}
+	return "", fmt.Errorf("compiler %s not found in PATH", cc.Compiler)
+}
+
+// CompilerFromJsonByDB returns the compiler of the first translation unit
+// of a database, see CompilerFromCommands.
+func CompilerFromJsonByDB(db []JsonTranslationunit) (string, error) {
+	cmds, err := CompileCommandsFromDB(db)
+	if err != nil {
+		return "", err
+	}
+	return CompilerFromCommands(cmds)
+}
+
+// CompilerFromCommands returns the compiler of the first compiler call, as
+// needed for the exe setting of a compiler in Compiler Explorer: without
+// launchers, and resolved to its path (see CompilerPath). If the compiler
+// can't be found on this machine, it is returned as given.
+func CompilerFromCommands(cmds []CompileCommand) (string, error) {
+	for _, cc := range cmds {
+		path, err := cc.CompilerPath()
+		if err != nil {
+			log.Printf("using compiler %s as given: %v", cc.Compiler, err)
+			path = cc.Compiler
+		}
+		return JoinArguments(append(append([]string{}, cc.Wrappers...), path)), nil
+	}
+	return "", fmt.Errorf("no translation units found")
+}
+
+// CompilerGroup are the translation units compiled with one compiler.
+// Compiler is the compiler as returned by CompilerFromCommands.
+type CompilerGroup struct {
+	Compiler string
+	Commands []CompileCommand
+}
+
+// GroupByCompiler splits compiler calls by the compiler they use, such as
+// gcc for C, clang++ for C++ and nvcc for CUDA sources. Compilers are
+// compared after resolving them (see CompilerFromCommands), such that g++
+// and /usr/bin/g++ are the same compiler. Groups are in the order in which
+// their compiler is first used.
+func GroupByCompiler(cmds []CompileCommand) []CompilerGroup {
+	var groups []CompilerGroup
+	index := make(map[string]int)
+	resolved := make(map[string]string)
+	for _, cc := range cmds {
+		// what the compiler resolves to depends on the call, the PATH and
+		// for relative paths on the working directory
+		key := []string{cc.CompilerCall()}
+		for _, e := range cc.Env {
+			if strings.HasPrefix(e, "PATH=") {
+				key = append(key, e)
+			}
+		}
+		if strings.Contains(cc.Compiler, "/") && !filepath.IsAbs(cc.Compiler) {
+			key = append(key, cc.Directory)
+		}
+		exe, found := resolved[strings.Join(key, "\x00")]
+		if !found {
+			exe, _ = CompilerFromCommands([]CompileCommand{cc})
+			resolved[strings.Join(key, "\x00")] = exe
+		}
+		if i, found := index[exe]; found {
+			groups[i].Commands = append(groups[i].Commands, cc)
+			continue
+		}
+		index[exe] = len(groups)
+		groups = append(groups, CompilerGroup{Compiler: exe, Commands: []CompileCommand{cc}})
+	}
+	return groups
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+package cc2ce
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitCompilerCall(t *testing.T) {
+	tests := []struct {
+		command string
+		want    compilerPrefix
+	}{
+		{
+			command: "g++ -c a.cpp",
+			want:    compilerPrefix{compiler: "g++", args: []string{"-c", "a.cpp"}},
+		},
+		{
+			command: "ccache g++ -c a.cpp",
+			want:    compilerPrefix{launchers: []string{"ccache"}, compiler: "g++", args: []string{"-c", "a.cpp"}},
+		},
+		{
+			command: "/usr/bin/ccache -- /usr/bin/g++ -c a.cpp",
+			want:    compilerPrefix{launchers: []string{"/usr/bin/ccache"}, compiler: "/usr/bin/g++", args: []string{"-c", "a.cpp"}},
+		},
+		{
+			command: "FOO=1 distcc icecc g++ -c a.cpp",
+			want:    compilerPrefix{env: []string{"FOO=1"}, launchers: []string{"distcc", "icecc"}, compiler: "g++", args: []string{"-c", "a.cpp"}},
+		},
+		{
+			command: "env -u BAR FOO=1 clang++ -c a.cpp",
+			want:    compilerPrefix{env: []string{"FOO=1"}, compiler: "clang++", args: []string{"-c", "a.cpp"}},
+		},
+		{
+			command: "env -C /x --unset=BAR clang++ a.cpp",
+			want:    compilerPrefix{directory: "/x", compiler: "clang++", args: []string{"a.cpp"}},
+		},
+		{
+			command: "cd sub && g++ -c a.cpp && touch done",
+			want:    compilerPrefix{directory: "sub", compiler: "g++", args: []string{"-c", "a.cpp"}},
+		},
+		{
+			command: "cd sub && cd deeper ; ccache g++ -c a.cpp",
+			want:    compilerPrefix{directory: "sub/deeper", launchers: []string{"ccache"}, compiler: "g++", args: []string{"-c", "a.cpp"}},
+		},
+		{
+			command: "/usr/bin/python3 wrap.py clang++ -c a.cpp",
+			want:    compilerPrefix{wrappers: []string{"/usr/bin/python3", "wrap.py"}, compiler: "clang++", args: []string{"-c", "a.cpp"}},
+		},
+		{
+			// response files of CMake with Ninja
+			command: "/usr/bin/c++ @CMakeFiles/x.rsp -c a.cpp",
+			want:    compilerPrefix{compiler: "/usr/bin/c++", args: []string{"@CMakeFiles/x.rsp", "-c", "a.cpp"}},
+		},
+		{
+			command: "ccache g++ @flags.rsp",
+			want:    compilerPrefix{launchers: []string{"ccache"}, compiler: "g++", args: []string{"@flags.rsp"}},
+		},
+		{
+			// precompiled headers
+			command: "g++ foo.hpp -o x",
+			want:    compilerPrefix{compiler: "g++", args: []string{"foo.hpp", "-o", "x"}},
+		},
+		{
+			command: "g++ pch.h",
+			want:    compilerPrefix{compiler: "g++", args: []string{"pch.h"}},
+		},
+		{
+			command: "clang++ a.hh",
+			want:    compilerPrefix{compiler: "clang++", args: []string{"a.hh"}},
+		},
+		{
+			command: "clang++ a.hxx",
+			want:    compilerPrefix{compiler: "clang++", args: []string{"a.hxx"}},
+		},
+		{
+			command: "g++ impl.ipp",
+			want:    compilerPrefix{compiler: "g++", args: []string{"impl.ipp"}},
+		},
+		{
+			// C++ module interfaces
+			command: "cl.exe m.ixx",
+			want:    compilerPrefix{compiler: "cl.exe", args: []string{"m.ixx"}},
+		},
+		{
+			command: "clang++ m.cppm --precompile",
+			want:    compilerPrefix{compiler: "clang++", args: []string{"m.cppm", "--precompile"}},
+		},
+		{
+			command: "clang++ m.mpp",
+			want:    compilerPrefix{compiler: "clang++", args: []string{"m.mpp"}},
+		},
+	}
+	for _, tt := range tests {
+		args, err := SplitCommand(tt.command)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := splitCompilerCall(args)
+		if err != nil {
+			t.Errorf("splitCompilerCall(%q) error: %v", tt.command, err)
+			continue
+		}
+		if !sameCompilerPrefix(got, tt.want) {
+			t.Errorf("splitCompilerCall(%q) = %+v, want %+v", tt.command, got, tt.want)
+		}
+	}
+}
+
+// sameCompilerPrefix compares compiler prefixes, not distinguishing empty
+// from nil slices.
+func sameCompilerPrefix(a, b compilerPrefix) bool {
+	sameWords := func(x, y []string) bool {
+		return len(x) == len(y) && (len(x) == 0 || reflect.DeepEqual(x, y))
+	}
+	return a.directory == b.directory && a.compiler == b.compiler &&
+		sameWords(a.env, b.env) && sameWords(a.launchers, b.launchers) &&
+		sameWords(a.wrappers, b.wrappers) && sameWords(a.args, b.args)
+}
+
+func TestSplitCompilerCallErrors(t *testing.T) {
+	for _, command := range []string{"", "ccache", "env FOO=1", "cd sub", "-c a.cpp"} {
+		args, _ := SplitCommand(command)
+		if _, err := splitCompilerCall(args); err == nil {
+			t.Errorf("splitCompilerCall(%q) gave no error", command)
+		}
+	}
+}
+
+func TestCompilerPathSkipsLauncherSymlinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cc2ce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bin := filepath.Join(dir, "bin")
+	masquerade := filepath.Join(dir, "ccache")
+	for _, d := range []string{bin, masquerade} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, exe := range []string{"g++", "ccache"} {
+		if err := ioutil.WriteFile(filepath.Join(bin, exe), []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(bin, "ccache"), filepath.Join(masquerade, "g++")); err != nil {
+		t.Fatal(err)
+	}
+
+	cc := CompileCommand{Directory: dir, Compiler: "g++", Env: []string{"PATH=" + masquerade + ":" + bin}}
+	if got, err := cc.CompilerPath(); err != nil || got != filepath.Join(bin, "g++") {
+		t.Errorf("CompilerPath() = %s, %v, want %s", got, err, filepath.Join(bin, "g++"))
+	}
+	cc.Compiler = filepath.Join(masquerade, "g++")
+	if got, err := cc.CompilerPath(); err != nil || got != filepath.Join(bin, "g++") {
+		t.Errorf("CompilerPath() for the symlink = %s, %v, want %s", got, err, filepath.Join(bin, "g++"))
+	}
+}
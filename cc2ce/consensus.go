@@ -0,0 +1,156 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+// This file contains an alternative to the "first translation unit" approach
+// of OptionsFromJsonByDB: options are only kept if they are used by (a
+// majority of) all translation units.
+
+package cc2ce
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// DroppedOption is an option which was not used by enough translation units
+// to be part of the consensus.
+type DroppedOption struct {
+	Option string
+	Uses   int // number of translation units using the option
+}
+
+// OptionConsensus is the result of ConsensusOptionsFromCommands.
+//   - Options is the options string for Compiler Explorer
+//   - Kept are the individual options in Options
+//   - Dropped are the options which were considered translation unit
+//     specific, in the order in which they were first seen
+//   - TranslationUnits is the number of translation units considered
+type OptionConsensus struct {
+	Options          string
+	Kept             []string
+	Dropped          []DroppedOption
+	TranslationUnits int
+}
+
+func (c OptionConsensus) String() string {
+	var dropped []string
+	for _, d := range c.Dropped {
+		dropped = append(dropped, fmt.Sprintf("%s (%d/%d)", d.Option, d.Uses, c.TranslationUnits))
+	}
+	return fmt.Sprintf("kept: %s; dropped: %s", c.Options, strings.Join(dropped, " "))
+}
+
+// ConsensusOptionsFromJsonByDB is ConsensusOptionsFromCommands for an
+// unparsed database.
+func ConsensusOptionsFromJsonByDB(db []JsonTranslationunit, threshold float64, skippackagenameversion bool) (OptionConsensus, error) {
+	cmds, err := CompileCommandsFromDB(db)
+	if err != nil {
+		return OptionConsensus{}, err
+	}
+	return ConsensusOptionsFromCommands(cmds, threshold, skippackagenameversion)
+}
+
+// ConsensusOptionsFromCommands selects the same kind of options as
+// OptionsFromCommands, but rather than taking them from the first
+// translation unit, it keeps those options which are used by at least the
+// fraction threshold of all translation units. A threshold of 1 means the
+// options common to all translation units, 0.5 means options used by at
+// least half of them.
+//
+// Defines of target specific rules (see DefineRule), such as *_EXPORTS or
+// GAUDI_LINKER_LIBRARY, are counted like other options. When only some
+// translation units use them, they end up in Dropped, such that they are
+// reported. When they reach the consensus, the rules are applied to them as
+// in OptionsFromCommands.
+//
+// NB: with a threshold of 0.5 or below, conflicting options (such as -O2 and
+// -O3) can both end up in the consensus, the later one wins then.
+func ConsensusOptionsFromCommands(cmds []CompileCommand, threshold float64, skippackagenameversion bool) (OptionConsensus, error) {
+	counter := newConsensusCounter(skippackagenameversion)
+	for _, cc := range cmds {
+		counter.add(cc)
+	}
+	return counter.result(threshold)
+}
+
+// consensusCounter counts how many translation units use each option,
+// remembering the order in which options were first seen.
+//   - targetSpecific holds the options that target specific rules were not
+//     applied to while counting, with what the rules make of them (an empty
+//     string if they drop them)
+type consensusCounter struct {
+	filter           optionFilter
+	uses             map[string]int
+	order            []string
+	targetSpecific   map[string]string
+	translationUnits int
+}
+
+func newConsensusCounter(skippackagenameversion bool) *consensusCounter {
+	c := &consensusCounter{
+		uses:           make(map[string]int),
+		targetSpecific: make(map[string]string),
+	}
+	c.filter = optionFilter{skipPackageNameVersion: skippackagenameversion, keepTargetSpecific: func(define string) bool {
+		option := ""
+		if applied, keep := DefaultDefineRules.apply(define, nil, skippackagenameversion); keep {
+			option = OptionArgument("-D" + applied)
+		}
+		c.targetSpecific[OptionArgument("-D"+define)] = option
+		return true
+	}}
+	return c
+}
+
+func (c *consensusCounter) add(cc CompileCommand) {
+	c.translationUnits++
+	seen := make(map[string]bool)
+	for _, o := range cc.options(c.filter) {
+		if seen[o] {
+			continue
+		}
+		seen[o] = true
+		if _, found := c.uses[o]; !found {
+			c.order = append(c.order, o)
+		}
+		c.uses[o]++
+	}
+}
+
+func (c *consensusCounter) result(threshold float64) (OptionConsensus, error) {
+	var consensus OptionConsensus
+	if c.translationUnits == 0 {
+		return consensus, fmt.Errorf("no translation units found")
+	}
+	if threshold <= 0 || threshold > 1 {
+		return consensus, fmt.Errorf("consensus threshold must be in (0,1], got %v", threshold)
+	}
+
+	consensus.TranslationUnits = c.translationUnits
+	needed := int(math.Ceil(threshold*float64(c.translationUnits) - 1e-9))
+	for _, o := range c.order {
+		if c.uses[o] >= needed {
+			if applied, found := c.targetSpecific[o]; found {
+				if applied == "" {
+					continue
+				}
+				o = applied
+			}
+			consensus.Kept = append(consensus.Kept, o)
+		} else {
+			consensus.Dropped = append(consensus.Dropped, DroppedOption{Option: o, Uses: c.uses[o]})
+		}
+	}
+	consensus.Options = strings.Join(consensus.Kept, " ")
+	return consensus, nil
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+package cc2ce
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConsensusTargetSpecificDefines(t *testing.T) {
+	tests := []struct {
+		name    string
+		db      []JsonTranslationunit
+		options string
+		dropped []DroppedOption
+	}{
+		{
+			name: "shared by all",
+			db: []JsonTranslationunit{
+				{Builddir: "/b", File: "a.cpp", Command: "g++ -Dfoo_EXPORTS -DGAUDI_LINKER_LIBRARY -DA -O2 -c a.cpp"},
+				{Builddir: "/b", File: "b.cpp", Command: "g++ -Dfoo_EXPORTS -DGAUDI_LINKER_LIBRARY -DA -O2 -c b.cpp"},
+			},
+			options: "-DA -O2",
+		},
+		{
+			name: "partial",
+			db: []JsonTranslationunit{
+				{Builddir: "/b", File: "a.cpp", Command: "g++ -Dfoo_EXPORTS -DA -O2 -c a.cpp"},
+				{Builddir: "/b", File: "b.cpp", Command: "g++ -Dbar_EXPORTS -DA -O2 -c b.cpp"},
+			},
+			options: "-DA -O2",
+			dropped: []DroppedOption{{"-Dfoo_EXPORTS", 1}, {"-Dbar_EXPORTS", 1}},
+		},
+		{
+			name: "pinned",
+			db: []JsonTranslationunit{
+				{Builddir: "/b", File: "a.cpp", Command: `g++ -DPACKAGE_NAME="Foo" -O2 -c a.cpp`},
+				{Builddir: "/b", File: "b.cpp", Command: `g++ -DPACKAGE_NAME="Foo" -O2 -c b.cpp`},
+			},
+			options: `-DPACKAGE_NAME="CompilerExplorer" -O2`,
+		},
+	}
+	for _, tt := range tests {
+		c, err := ConsensusOptionsFromJsonByDB(tt.db, 1, false)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if c.Options != tt.options {
+			t.Errorf("%s: got options %q, want %q", tt.name, c.Options, tt.options)
+		}
+		if !reflect.DeepEqual(c.Dropped, tt.dropped) {
+			t.Errorf("%s: got dropped %v, want %v", tt.name, c.Dropped, tt.dropped)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+// This file contains the check which flags a compiler supports, by
+// compiling an empty file with each flag. Unlike the table of
+// TranslateOptions, this also finds flags of compilers nobody told us about.
+
+package cc2ce
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// flagProbeLanguages maps languages to the argument of -x for compiling an
+// empty file. Languages not listed (such as CUDA, as nvcc's flags work
+// differently) are not probed.
+var flagProbeLanguages = map[string]string{
+	LanguageCpp:     "c++",
+	LanguageC:       "c",
+	LanguageFortran: "f95",
+}
+
+// ProbeFlag compiles an empty file of a language with a flag (given as its
+// words, e.g. ["--param", "max-inline-insns=5"]) and -Werror, such that
+// flags the compiler only warns about count as unsupported. An error is
+// returned if the compiler could not be run at all.
+func ProbeFlag(exe string, language string, flag []string) (bool, error) {
+	call, err := SplitCommand(exe)
+	if err != nil {
+		return false, err
+	}
+	if len(call) == 0 {
+		return false, fmt.Errorf("no compiler given")
+	}
+	x, found := flagProbeLanguages[language]
+	if !found {
+		return false, fmt.Errorf("can't probe flags for %s", language)
+	}
+	args := append(append([]string{}, flag...), "-Werror", "-x", x, "-c", os.DevNull, "-o", os.DevNull)
+	_, err = runCompiler(call, args...)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// FlagSupported is ProbeFlag with caching.
+func (c *CompilerCache) FlagSupported(exe string, language string, flag []string) (bool, error) {
+	if c == nil {
+		return ProbeFlag(exe, language, flag)
+	}
+	entry, err := c.entry(exe)
+	if err != nil {
+		return false, err
+	}
+	key := language + " " + JoinArguments(flag)
+	if supported, found := entry.Flags[key]; found {
+		return supported, nil
+	}
+	supported, err := ProbeFlag(exe, language, flag)
+	if err != nil {
+		return supported, err
+	}
+	if entry.Flags == nil {
+		entry.Flags = make(map[string]bool)
+	}
+	entry.Flags[key] = supported
+	c.entries[exe] = entry
+	c.changed = true
+	return supported, nil
+}
+
+// optionFlags groups the words of an options string (as written, see
+// splitOptionWords) into flags, where flags taking a separate argument
+// (such as --param, -mllvm or -include) get their argument, so that they
+// are probed and removed together.
+func optionFlags(options string) [][]string {
+	var flags [][]string
+	words := splitOptionWords(options)
+	for i := 0; i < len(words); i++ {
+		n := 1
+		if _, separated := separatedArgumentFlags[words[i]]; separated {
+			n = 2
+		} else if _, _, matched, _ := matchIncludeFlag(words, i); matched == 2 {
+			n = 2
+		}
+		if i+n > len(words) {
+			n = len(words) - i
+		}
+		flags = append(flags, words[i:i+n])
+		i += n - 1
+	}
+	return flags
+}
+
+// SupportedOptions removes the flags a compiler doesn't support from its
+// options (as from OptionsFromCommands), see FlagSupported. Defines are
+// not checked. It returns the remaining options and the removed flags.
+// Options of languages that can't be probed (CUDA) are returned unchanged.
+//
+// Before checking any flag, the compiler must be able to compile an empty
+// file without flags, otherwise (e.g. when it needs an environment that
+// isn't set up) all flags would appear unsupported and an error is
+// returned.
+func (c *CompilerCache) SupportedOptions(exe string, language string, options string) (string, []string, error) {
+	if _, found := flagProbeLanguages[language]; !found || options == "" {
+		return options, nil, nil
+	}
+	if works, err := c.FlagSupported(exe, language, nil); err != nil {
+		return options, nil, err
+	} else if !works {
+		return options, nil, fmt.Errorf("%s can't compile an empty %s file", exe, language)
+	}
+	var kept, removed []string
+	for _, flag := range optionFlags(options) {
+		written := strings.Join(flag, " ")
+		if strings.HasPrefix(written, "-D") || strings.HasPrefix(written, "-U") {
+			kept = append(kept, written)
+			continue
+		}
+		words, err := SplitCommand(written)
+		if err != nil {
+			return options, nil, err
+		}
+		supported, err := c.FlagSupported(exe, language, words)
+		if err != nil {
+			return options, nil, err
+		}
+		if supported {
+			kept = append(kept, written)
+		} else {
+			removed = append(removed, written)
+		}
+	}
+	return strings.Join(kept, " "), removed, nil
+}
@@ -0,0 +1,233 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+package cc2ce
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeFlagProbes is fakeRunCompiler for compilers which fail, as with an
+// exit status, on the given flags (in the form they are probed, e.g.
+// "-mllvm -foo", or "" for the probe without flags).
+func fakeFlagProbes(t *testing.T, unsupported ...string) *[]string {
+	calls := fakeRunCompiler(t)
+	canned := runCompiler
+	runCompiler = func(call []string, args ...string) (string, error) {
+		probe := strings.Join(args, " ")
+		for _, flag := range unsupported {
+			if strings.HasPrefix(probe, strings.TrimSpace(flag+" -Werror")+" ") {
+				*calls = append(*calls, strings.Join(append(append([]string{}, call...), args...), " "))
+				return "error: unrecognized command-line option " + flag, &exec.ExitError{}
+			}
+		}
+		return canned(call, args...)
+	}
+	return calls
+}
+
+// probedFlags returns the flags of the probe calls of a one word compiler
+// call, "" for the probe without flag.
+func probedFlags(calls []string) []string {
+	var flags []string
+	for _, c := range calls {
+		i := strings.Index(c, " -Werror ")
+		if i < 0 {
+			continue
+		}
+		flag := ""
+		if j := strings.Index(c[:i], " "); j >= 0 {
+			flag = c[j+1 : i]
+		}
+		flags = append(flags, flag)
+	}
+	return flags
+}
+
+func TestOptionFlags(t *testing.T) {
+	tests := []struct {
+		options string
+		want    [][]string
+	}{
+		{"", nil},
+		{"-O2 -g", [][]string{{"-O2"}, {"-g"}}},
+		{"--param max-inline-insns=5 -O2", [][]string{{"--param", "max-inline-insns=5"}, {"-O2"}}},
+		{"-mllvm -inline-threshold=100 -march=native", [][]string{{"-mllvm", "-inline-threshold=100"}, {"-march=native"}}},
+		{"-Xclang -fno-pch-timestamp", [][]string{{"-Xclang", "-fno-pch-timestamp"}}},
+		{"-include config.h -O2", [][]string{{"-include", "config.h"}, {"-O2"}}},
+		{"-DX=\"a b\" -U NDEBUG", [][]string{{"-DX=\"a b\""}, {"-U", "NDEBUG"}}},
+		// a flag missing its argument at the end
+		{"-O2 -mllvm", [][]string{{"-O2"}, {"-mllvm"}}},
+	}
+	for _, tt := range tests {
+		if got := optionFlags(tt.options); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.options, got, tt.want)
+		}
+	}
+}
+
+func TestProbeFlag(t *testing.T) {
+	calls := fakeFlagProbes(t, "-fconcepts-ts")
+	tests := []struct {
+		flag []string
+		want bool
+	}{
+		{nil, true},
+		{[]string{"-O2"}, true},
+		{[]string{"-fconcepts-ts"}, false},
+		{[]string{"--param", "max-inline-insns=5"}, true},
+	}
+	for _, tt := range tests {
+		got, err := ProbeFlag("g++", LanguageCpp, tt.flag)
+		if err != nil || got != tt.want {
+			t.Errorf("%q: got %v, %v, want %v", tt.flag, got, err, tt.want)
+		}
+	}
+	want := []string{
+		"g++ -Werror -x c++ -c /dev/null -o /dev/null",
+		"g++ -O2 -Werror -x c++ -c /dev/null -o /dev/null",
+		"g++ -fconcepts-ts -Werror -x c++ -c /dev/null -o /dev/null",
+		"g++ --param max-inline-insns=5 -Werror -x c++ -c /dev/null -o /dev/null",
+	}
+	if !reflect.DeepEqual(*calls, want) {
+		t.Errorf("got calls %q, want %q", *calls, want)
+	}
+
+	if _, err := ProbeFlag("/opt/missing/xlC", LanguageCpp, []string{"-O2"}); err == nil {
+		t.Error("no error for a compiler that can't be run")
+	}
+	if _, err := ProbeFlag("g++", LanguageCuda, []string{"-O2"}); err == nil {
+		t.Error("no error for a language that can't be probed")
+	}
+}
+
+func TestSupportedOptionsRemoval(t *testing.T) {
+	tests := []struct {
+		name        string
+		unsupported []string
+		options     string
+		want        string
+		removed     []string
+		probed      []string
+	}{
+		{
+			name:        "removal",
+			unsupported: []string{"-fconcepts-ts", "-Wno-unknown-warning-option"},
+			options:     "-std=c++17 -fconcepts-ts -O2 -Wno-unknown-warning-option",
+			want:        "-std=c++17 -O2",
+			removed:     []string{"-fconcepts-ts", "-Wno-unknown-warning-option"},
+			probed:      []string{"", "-std=c++17", "-fconcepts-ts", "-O2", "-Wno-unknown-warning-option"},
+		},
+		{
+			name:        "flag with argument",
+			unsupported: []string{"-mllvm -enable-misched"},
+			options:     "-O2 -mllvm -enable-misched -mllvm -inline-threshold=100",
+			want:        "-O2 -mllvm -inline-threshold=100",
+			removed:     []string{"-mllvm -enable-misched"},
+			probed:      []string{"", "-O2", "-mllvm -enable-misched", "-mllvm -inline-threshold=100"},
+		},
+		{
+			name:        "quoted argument",
+			unsupported: []string{"--param max-inline-insns=5"},
+			options:     "--param max-inline-insns=5 -Xclang '-fno-pch-timestamp'",
+			want:        "-Xclang '-fno-pch-timestamp'",
+			removed:     []string{"--param max-inline-insns=5"},
+			probed:      []string{"", "--param max-inline-insns=5", "-Xclang -fno-pch-timestamp"},
+		},
+		{
+			name:        "defines aren't probed",
+			unsupported: []string{"-DX=1"},
+			options:     "-DX=1 -U NDEBUG -O2",
+			want:        "-DX=1 -U NDEBUG -O2",
+			probed:      []string{"", "-O2"},
+		},
+	}
+	for _, tt := range tests {
+		calls := fakeFlagProbes(t, tt.unsupported...)
+		var cache *CompilerCache
+		got, removed, err := cache.SupportedOptions("g++", LanguageCpp, tt.options)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want || !reflect.DeepEqual(removed, tt.removed) {
+			t.Errorf("%s: got %q without %q, want %q without %q", tt.name, got, removed, tt.want, tt.removed)
+		}
+		if probed := probedFlags(*calls); !reflect.DeepEqual(probed, tt.probed) {
+			t.Errorf("%s: probed %q, want %q", tt.name, probed, tt.probed)
+		}
+	}
+
+	// a compiler that can't compile anything
+	fakeFlagProbes(t, "")
+	var cache *CompilerCache
+	if got, _, err := cache.SupportedOptions("g++", LanguageCpp, "-O2"); err == nil || got != "-O2" {
+		t.Errorf("broken compiler: got %q, %v", got, err)
+	}
+	// CUDA isn't probed
+	calls := fakeFlagProbes(t)
+	if got, removed, err := cache.SupportedOptions("nvcc", LanguageCuda, "-O2 --expt-relaxed-constexpr"); err != nil || got != "-O2 --expt-relaxed-constexpr" || removed != nil || len(*calls) != 0 {
+		t.Errorf("CUDA: got %q without %q, %v after %q", got, removed, err, *calls)
+	}
+}
+
+func TestFlagSupportedCache(t *testing.T) {
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "g++")
+	if err := ioutil.WriteFile(exe, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cachePath := filepath.Join(dir, "cache.json")
+	cache, err := OpenCompilerCache(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := fakeFlagProbes(t, "-fconcepts-ts")
+	options := "-O2 -fconcepts-ts -mllvm -inline-threshold=100"
+	for i := 0; i < 2; i++ {
+		got, removed, err := cache.SupportedOptions(exe, LanguageCpp, options)
+		if err != nil || got != "-O2 -mllvm -inline-threshold=100" || !reflect.DeepEqual(removed, []string{"-fconcepts-ts"}) {
+			t.Errorf("run %d: got %q without %q, %v", i, got, removed, err)
+		}
+	}
+	if len(*calls) != 4 {
+		t.Errorf("got %d probes, want one for the empty file and one per flag: %q", len(*calls), *calls)
+	}
+	// the results are per language
+	if _, _, err := cache.SupportedOptions(exe, LanguageC, "-O2"); err != nil {
+		t.Fatal(err)
+	}
+	if len(*calls) != 6 {
+		t.Errorf("got %d probes after probing C, want 6", len(*calls))
+	}
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenCompilerCache(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls = fakeFlagProbes(t)
+	if supported, err := reopened.FlagSupported(exe, LanguageCpp, []string{"-fconcepts-ts"}); err != nil || supported {
+		t.Errorf("from the cache file: got %v, %v", supported, err)
+	}
+	if len(*calls) != 0 {
+		t.Errorf("probed %q with a cached result", *calls)
+	}
+}
@@ -17,12 +17,8 @@
 package cc2ce
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"os"
-	"path/filepath"
 	"strings"
 )
 
@@ -31,61 +27,71 @@ type JsonTranslationunit struct {
 	Command  string `json:"command"`   // contains the compiler call
 	File     string `json:"file"`      // input file
 
-	Arguments []string `json:"arguments"` // alternative to 'command' (list of strings rather than string) FIXME: handle
+	Arguments []string `json:"arguments"` // alternative to 'command' (list of strings rather than string)
 	Output    string   `json:"output"`    // optional, unused
 }
 
+// Argv returns the compiler call of a translation unit as list of words,
+// regardless of whether the database entry used the 'command' or the
+// 'arguments' form. When both are present, 'arguments' takes precedence (as
+// in the clang specification of the format). The 'command' string is split
+// with shell quoting rules (see SplitCommand), such that the result is the
+// argument list the compiler actually received.
+func (tu JsonTranslationunit) Argv() ([]string, error) {
+	if len(tu.Arguments) != 0 {
+		return tu.Arguments, nil
+	}
+	return SplitCommand(tu.Command)
+}
+
 // IncludesFromJsonByBytes parses json provided as []byte (and is called by
-// ParseJsonByFilename). It collects all include paths given in the form
-// `-Isomepath` and `-isystem somepath`.
+// ParseJsonByFilename). It collects all include paths given with any of the
+// GCC/Clang include flags (see IncludeDirsFromArgs).
 //
-// The return is a quasi-'set' of strings: a map string -> bool.  All bools are
-// true. An include path is present in the compile_commands if and only if it
-// is present as key in the map.
+// The return is an IncludeSet, which keeps the paths in the order in which
+// they were first seen, together with their kind and how many translation
+// units used them.
 //
 // When the turnAbsolute option is true, relative paths get turned into
 // absolute paths by using the specified working directory from the json.
 // Otherwise, no path manipulation is done.
-func IncludesFromJsonByBytes(inFileContent []byte, turnAbsolute bool) (map[string]bool, error) {
+func IncludesFromJsonByBytes(inFileContent []byte, turnAbsolute bool) (IncludeSet, error) {
 	db, err := JsonTUsByBytes(inFileContent)
 
 	if nil != err {
-		return make(map[string]bool), err
+		return IncludeSet{}, err
 	}
 
 	return IncludesFromJsonByDB(db, turnAbsolute)
 }
 
-func IncludesFromJsonByDB(db []JsonTranslationunit, turnAbsolute bool) (map[string]bool, error) {
-	stringset := make(map[string]bool)
-	for _, tu := range db {
-		words := strings.Fields(tu.Command)
-		for j, w := range words {
-			inc := ""
-			if w[0:2] == "-I" {
-				inc = w[2:len(w)]
-			}
-			if w == "-isystem" {
-				inc = words[j+1]
-			}
-			if inc != "" {
-				if !filepath.IsAbs(inc) && turnAbsolute {
-					inc = filepath.Join(tu.Builddir, inc)
-				}
-				stringset[inc] = true
-			}
-		}
+func IncludesFromJsonByDB(db []JsonTranslationunit, turnAbsolute bool) (IncludeSet, error) {
+	cmds, err := CompileCommandsFromDB(db)
+	if err != nil {
+		return IncludeSet{}, err
 	}
-	return stringset, nil
+	return IncludesFromCommands(cmds, turnAbsolute), nil
+}
+
+// IncludesFromCommands collects the include paths of already parsed compiler
+// calls, see IncludesFromJsonByBytes.
+func IncludesFromCommands(cmds []CompileCommand, turnAbsolute bool) IncludeSet {
+	var includes IncludeSet
+	for _, cc := range cmds {
+		includes.AddTranslationUnit(cc.IncludePaths(turnAbsolute))
+	}
+	return includes
 }
 
 // Attempt to get compiler options from the compile_commands.json. On a pure
 // luck based approach, the compile command of the first translation unit is
-// used to extract -W, -m, -f, -p, -std, -O, and -D settings.  These may well
-// differ from one translation unit to the other.
+// used to extract the flags allowed by DefaultFlagPolicy, by default the
+// defines, warning, optimization, code generation, target and language
+// standard flags.  These may well differ from one translation unit to the
+// other.
 //
-// The -D options are filtered based on what I found not useful in LHCb
-// projects.
+// The -D options are filtered with DefaultDefineRules, by default the
+// "gaudi" preset of what I found not useful in LHCb projects.
 func OptionsFromJsonByBytes(inFileContent []byte, skippackagenameversion bool) (string, error) {
 	db, err := JsonTUsByBytes(inFileContent)
 	if nil != err {
@@ -96,81 +102,93 @@ func OptionsFromJsonByBytes(inFileContent []byte, skippackagenameversion bool) (
 }
 
 func OptionsFromJsonByDB(db []JsonTranslationunit, skippackagenameversion bool) (string, error) {
-	var b bytes.Buffer
-	for _, tu := range db {
-		words := strings.Fields(tu.Command)
-		for _, w := range words {
-			if strings.HasPrefix(w, "-D") {
-				if strings.HasSuffix(w, "EXPORTS") {
-					continue
-				} else if strings.HasPrefix(w, "-DPACKAGE_NAME") {
-					if !skippackagenameversion {
-						b.WriteString("-DPACKAGE_NAME=\"CompilerExplorer\"")
-					}
-				} else if strings.HasPrefix(w, "-DPACKAGE_VERSION") {
-					if !skippackagenameversion {
-						b.WriteString("-DPACKAGE_VERSION=\"v0r0\"")
-					}
-				} else if w == "-DGAUDI_LINKER_LIBRARY" {
-					continue
-				} else {
-					// In the .json I often see -Dsomevar=\\\"someval\\\"
-					// For the .properties this needs to be -Dsomevar="someval" with all backslashes gone
-					// NB: in the past I used 7 backslashes instead of 3. At the time of writing this comment
-					//     I have to change 7 to 3 to fix production. I did not verify if this is a change
-					//     in go (encoding/json?). According to the previous comment, this is not a change
-					//     in cmake (observations match).
-					b.WriteString(strings.Replace(w, "\\\"", "\"", 2))
-				}
-			} else if strings.HasPrefix(w, "-p") {
-				b.WriteString(w)
-			} else if strings.HasPrefix(w, "-O") {
-				b.WriteString(w)
-			} else if strings.HasPrefix(w, "-m") {
-				b.WriteString(w)
-			} else if strings.HasPrefix(w, "-f") {
-				b.WriteString(w)
-			} else if strings.HasPrefix(w, "-W") {
-				b.WriteString(w)
-			} else if strings.HasPrefix(w, "-std") {
-				b.WriteString(w)
-			} else {
-				continue
+	cmds, err := CompileCommandsFromDB(db)
+	if err != nil {
+		return "", err
+	}
+	return OptionsFromCommands(cmds, skippackagenameversion)
+}
+
+// OptionsFromCommands is OptionsFromJsonByDB for already parsed compiler
+// calls.
+func OptionsFromCommands(cmds []CompileCommand, skippackagenameversion bool) (string, error) {
+	for _, cc := range cmds {
+		return strings.Join(cc.options(optionFilter{skipPackageNameVersion: skippackagenameversion}), " "), nil
+	}
+	return "", fmt.Errorf("no translation units found")
+}
+
+// optionFilter configures how DefaultDefineRules get applied by
+// CompileCommand.options.
+//   - skipPackageNameVersion drops the defines the rules pin (such as
+//     PACKAGE_NAME and PACKAGE_VERSION) rather than setting them to their
+//     pinned values
+//   - keepTargetSpecific tells which defines target specific rules (see
+//     DefineRule) don't get applied to, for callers that look at all
+//     translation units and can tell themselves what is target specific
+type optionFilter struct {
+	skipPackageNameVersion bool
+	keepTargetSpecific     func(define string) bool
+}
+
+// options selects the flags of a compiler call which should go into the
+// options of a compiler in Compiler Explorer, as allowed by
+// DefaultFlagPolicy. Each entry of the return value is one flag (quoted
+// where needed), e.g. "-O2" or "--param max-inline-insns=5".
+func (cc CompileCommand) options(filter optionFilter) []string {
+	var words []string
+	for _, flag := range cc.Flags {
+		if !DefaultFlagPolicy.Allows(flag) {
+			continue
+		}
+		switch flag.Category {
+		case FlagDefine:
+			define, keep := DefaultDefineRules.apply(flag.Value, filter.keepTargetSpecific, filter.skipPackageNameVersion)
+			if keep {
+				// In the .json I often see -Dsomevar=\\\"someval\\\"
+				// which the shell splitting already turned into
+				// -Dsomevar="someval", as needed for the .properties.
+				words = append(words, OptionArgument("-D"+define))
 			}
-			b.WriteString(" ")
+		default:
+			words = append(words, JoinOptions(flag.Args))
 		}
-		return b.String(), nil
 	}
-	return "", fmt.Errorf("no translation units found")
+	return words
 }
 
-// ParseJsonByFilename opens a compile_commands.json file and passes it to
-// IncludesFromJsonByBytes to get the union of all include paths. If the
-// argument ends on "compile_commands.json", it is assumed to be the path to
-// the compile_commands.json file. Otherwise, it is assumed to be the directory
-// containing the compile_commands.json file.
+// ParseJsonByFilename opens a compilation database (see OpenDatabase for
+// the accepted names, e.g. a compile_commands.json file or the directory
+// containing it) and collects the union of all include paths.
 //
-// The return is a quasi-'set' of strings: a map string -> bool.  All bools are
-// true. An include path is present in the compile_commands if and only if it
-// is present as key in the map.
+// The return is an IncludeSet, see IncludesFromJsonByBytes.
 //
 // When the turnAbsolute option is true, relative paths get turned into
 // absolute paths by using the specified working directory from the json.
 // Otherwise, no path manipulation is done.
-func ParseJsonByFilename(inFileName string, turnAbsolute bool) (map[string]bool, error) {
-	stringset := make(map[string]bool)
-	db, err := JsonTUsByFilename(inFileName)
-	if nil != err {
-		return stringset, err
+//
+// The file is streamed (see IncludesFromReader), rather than read into
+// memory as a whole. A compile_flags.txt, a CMake File API reply and Meson
+// introspection files are accepted as well, see JsonTUsByFilename.
+func ParseJsonByFilename(inFileName string, turnAbsolute bool) (IncludeSet, error) {
+	if db, found, err := otherFormatTUs(inFileName); found {
+		if err != nil {
+			return IncludeSet{}, err
+		}
+		return IncludesFromJsonByDB(db, turnAbsolute)
 	}
-	return IncludesFromJsonByDB(db, turnAbsolute)
+	jsonFile, err := OpenDatabase(inFileName)
+	if err != nil {
+		return IncludeSet{}, err
+	}
+	defer jsonFile.Close()
+	return IncludesFromReader(jsonFile, turnAbsolute)
 }
 
+// BytesFromFilename reads a compilation database, see OpenDatabase for the
+// accepted names.
 func BytesFromFilename(inFileName string) ([]byte, error) {
-	if !strings.HasSuffix(inFileName, "compile_commands.json") {
-		inFileName = filepath.Join(inFileName, "compile_commands.json")
-	}
-	jsonFile, err := os.Open(inFileName)
+	jsonFile, err := OpenDatabase(inFileName)
 	if err != nil {
 		retval := make([]byte, 0)
 		return retval, err
@@ -181,14 +199,44 @@ func BytesFromFilename(inFileName string) ([]byte, error) {
 	return byteValue, err
 }
 
+// JsonTUsByBytes decodes a compilation database. Malformed json and entries
+// lacking required fields are reported as errors, see ValidateJsonByBytes.
 func JsonTUsByBytes(inFileContent []byte) ([]JsonTranslationunit, error) {
-	var db []JsonTranslationunit
-	json.Unmarshal(inFileContent, &db)
+	return decodeDatabase(inFileContent, false)
+}
 
-	return db, nil
+// otherFormatTUs reads inFileName if it is not a compilation database but
+// one of the other supported inputs, see JsonTUsByFilename.
+func otherFormatTUs(inFileName string) ([]JsonTranslationunit, bool, error) {
+	if flagsFile, found := compileFlagsFilename(inFileName); found {
+		db, err := CompileFlagsTUsByFilename(flagsFile)
+		return db, true, err
+	}
+	if replyDir, found := cmakeReplyDir(inFileName); found {
+		model, err := CMakeCodemodelByDirectory(replyDir, "")
+		return model.TranslationUnits, true, err
+	}
+	if infoDir, found := mesonInfoDir(inFileName); found {
+		intro, err := MesonIntrospectionByDirectory(infoDir)
+		return intro.TranslationUnits, true, err
+	}
+	return nil, false, nil
 }
 
+// JsonTUsByFilename reads a compilation database, see OpenDatabase for the
+// accepted names. Other inputs are recognised by name, when inFileName is
+//   - a compile_flags.txt (or a directory with a compile_flags.txt and
+//     without compile_commands.json), which is read as database with a
+//     single translation unit, see CompileFlagsTUsByFilename
+//   - a CMake File API reply directory (or a build directory with a reply
+//     and without compile_commands.json), see CMakeCodemodelByDirectory
+//   - Meson's meson-info directory or the intro-targets.json in it (or a
+//     build directory with meson-info and without compile_commands.json),
+//     see MesonIntrospectionByDirectory
 func JsonTUsByFilename(inFileName string) ([]JsonTranslationunit, error) {
+	if db, found, err := otherFormatTUs(inFileName); found {
+		return db, err
+	}
 	inFileContent, err := BytesFromFilename(inFileName)
 	if nil != err {
 		return make([]JsonTranslationunit, 0), err
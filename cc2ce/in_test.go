@@ -0,0 +1,78 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+package cc2ce
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestArgv(t *testing.T) {
+	tests := []struct {
+		name string
+		tu   JsonTranslationunit
+		want []string
+	}{
+		{
+			name: "command only",
+			tu:   JsonTranslationunit{Command: "g++ -Iinc -isystem /usr/local/include -c a.cpp"},
+			want: []string{"g++", "-Iinc", "-isystem", "/usr/local/include", "-c", "a.cpp"},
+		},
+		{
+			name: "arguments only",
+			tu:   JsonTranslationunit{Arguments: []string{"g++", "-I/path with spaces", "-c", "a.cpp"}},
+			want: []string{"g++", "-I/path with spaces", "-c", "a.cpp"},
+		},
+		{
+			name: "both, arguments win",
+			tu: JsonTranslationunit{
+				Command:   "clang++ -Iwrong -c a.cpp",
+				Arguments: []string{"g++", "-Iright", "-c", "a.cpp"},
+			},
+			want: []string{"g++", "-Iright", "-c", "a.cpp"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.tu.Argv()
+			if err != nil {
+				t.Fatalf("Argv() error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Argv() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestArgvFromJson(t *testing.T) {
+	content := []byte(`[
+{"directory": "/b", "file": "a.cpp", "command": "g++ -Ia -c a.cpp"},
+{"directory": "/b", "file": "b.cpp", "arguments": ["g++", "-Ib", "-c", "b.cpp"]},
+{"directory": "/b", "file": "c.cpp", "command": "g++ -Iwrong -c c.cpp", "arguments": ["g++", "-Ic", "-c", "c.cpp"]}
+]`)
+	db, err := JsonTUsByBytes(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a", "b", "c"}
+	for i, tu := range db {
+		argv, err := tu.Argv()
+		if err != nil {
+			t.Fatalf("%s: %v", tu.File, err)
+		}
+		if argv[1] != "-I"+want[i] {
+			t.Errorf("%s: include flag %s, want -I%s", tu.File, argv[1], want[i])
+		}
+	}
+}
@@ -0,0 +1,212 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+// This file contains the recognition of the GCC/Clang command line flags that
+// add directories to the header search path.
+
+package cc2ce
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// IncludeKind tells to which of the compiler's search lists an include path
+// was added. The compiler searches them in the order of the constants below
+// (quote directories only for #include "...").
+type IncludeKind int
+
+const (
+	IncludeQuote  IncludeKind = iota // -iquote
+	IncludeUser                      // -I
+	IncludeSystem                    // -isystem
+	IncludeAfter                     // -idirafter
+)
+
+func (k IncludeKind) String() string {
+	switch k {
+	case IncludeQuote:
+		return "quote"
+	case IncludeUser:
+		return "user"
+	case IncludeSystem:
+		return "system"
+	case IncludeAfter:
+		return "after"
+	}
+	return fmt.Sprintf("IncludeKind(%d)", int(k))
+}
+
+// IncludeDir is a single include path as found on a command line, together
+// with the flag that added it.
+type IncludeDir struct {
+	Path string
+	Kind IncludeKind
+	Flag string
+}
+
+type includeFlagAction int
+
+const (
+	addDir              includeFlagAction = iota
+	setPrefix                             // -iprefix
+	addPrefixedDir                        // -iwithprefix, -iwithprefixbefore
+	setSysroot                            // --sysroot
+	setHeaderSysroot                      // -isysroot (takes precedence over --sysroot for headers)
+	ignoreIncludeOption                   // takes an argument, but adds no directory
+)
+
+type includeFlag struct {
+	spelling string
+	kind     IncludeKind
+	action   includeFlagAction
+	joinedEq bool // only the --flag=value form is joined, --flagvalue is not
+}
+
+// includeFlags lists the include related flags of GCC and Clang. Where one
+// spelling is a prefix of another one, the longer one must come first.
+var includeFlags = []includeFlag{
+	{"--include-directory-after", IncludeAfter, addDir, true},
+	{"--include-directory", IncludeUser, addDir, true},
+	{"--include-with-prefix-before", IncludeUser, addPrefixedDir, true},
+	{"--include-with-prefix-after", IncludeAfter, addPrefixedDir, true},
+	{"--include-with-prefix", IncludeAfter, addPrefixedDir, true},
+	{"--include-prefix", IncludeUser, setPrefix, true},
+	{"--sysroot", IncludeSystem, setSysroot, true},
+	{"-cxx-isystem", IncludeSystem, addDir, false},
+	{"-isystem-after", IncludeAfter, addDir, false},
+	{"-isystem", IncludeSystem, addDir, false},
+	{"-isysroot", IncludeSystem, setHeaderSysroot, false},
+	{"-iquote", IncludeQuote, addDir, false},
+	{"-idirafter", IncludeAfter, addDir, false},
+	{"-iwithprefixbefore", IncludeUser, addPrefixedDir, false},
+	{"-iwithprefix", IncludeAfter, addPrefixedDir, false},
+	{"-iprefix", IncludeUser, setPrefix, false},
+	{"-I", IncludeUser, addDir, false},
+	// options which take a separate argument that must not be mistaken
+	// for anything else
+	{"-include-pch", IncludeUser, ignoreIncludeOption, false},
+	{"-include", IncludeUser, ignoreIncludeOption, false},
+	{"-imacros", IncludeUser, ignoreIncludeOption, false},
+}
+
+// matchIncludeFlag checks if args[i] is an include related flag and returns
+// the flag, its value, and how many words were consumed.
+func matchIncludeFlag(args []string, i int) (includeFlag, string, int, error) {
+	w := args[i]
+	for _, f := range includeFlags {
+		if !strings.HasPrefix(w, f.spelling) {
+			continue
+		}
+		if w == f.spelling {
+			if i+1 >= len(args) {
+				return f, "", 1, &DanglingArgumentError{Flag: w}
+			}
+			return f, args[i+1], 2, nil
+		}
+		rest := w[len(f.spelling):]
+		if f.joinedEq {
+			if !strings.HasPrefix(rest, "=") {
+				continue
+			}
+			rest = rest[1:]
+		}
+		return f, rest, 1, nil
+	}
+	return includeFlag{}, "", 0, nil
+}
+
+// IncludeDirsFromArgs finds all directories which the compiler call args
+// adds to the header search path, in the order in which they appear. This
+// covers
+//   - -I, -iquote, -isystem, -idirafter, -cxx-isystem, -isystem-after, both
+//     in the joined (-Ipath) and separated (-I path) form
+//   - --include-directory=, --include-directory-after=
+//   - -iprefix/-iwithprefix/-iwithprefixbefore (and their long forms)
+//   - paths starting with '=' or '$SYSROOT' which are relative to the
+//     --sysroot (or -isysroot)
+//   - the obsolete -I- which turns all preceding -I paths into -iquote
+//     paths
+//
+// No path manipulation beyond the sysroot and prefix handling is done, in
+// particular relative paths stay relative.
+func IncludeDirsFromArgs(args []string) ([]IncludeDir, error) {
+	// the sysroot applies regardless of where on the command line it is given
+	sysroot := ""
+	headersysroot := ""
+	for i := 0; i < len(args); i++ {
+		f, val, n, err := matchIncludeFlag(args, i)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			continue
+		}
+		switch f.action {
+		case setSysroot:
+			sysroot = val
+		case setHeaderSysroot:
+			headersysroot = val
+		}
+		i += n - 1
+	}
+	if headersysroot != "" {
+		sysroot = headersysroot
+	}
+
+	var dirs []IncludeDir
+	prefix := ""
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-I-" {
+			for j := range dirs {
+				if dirs[j].Kind == IncludeUser {
+					dirs[j].Kind = IncludeQuote
+				}
+			}
+			continue
+		}
+		f, val, n, err := matchIncludeFlag(args, i)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			continue
+		}
+		i += n - 1
+		switch f.action {
+		case setPrefix:
+			prefix = val
+		case addPrefixedDir:
+			// gcc concatenates without adding a separator
+			dirs = append(dirs, IncludeDir{Path: prefix + val, Kind: f.kind, Flag: f.spelling})
+		case addDir:
+			if strings.HasPrefix(val, "=") {
+				val = filepath.Join(sysrootOrRoot(sysroot), val[1:])
+			} else if strings.HasPrefix(val, "$SYSROOT") {
+				val = filepath.Join(sysrootOrRoot(sysroot), val[len("$SYSROOT"):])
+			}
+			if val == "" {
+				continue
+			}
+			dirs = append(dirs, IncludeDir{Path: val, Kind: f.kind, Flag: f.spelling})
+		}
+	}
+	return dirs, nil
+}
+
+func sysrootOrRoot(sysroot string) string {
+	if sysroot == "" {
+		return "/"
+	}
+	return sysroot
+}
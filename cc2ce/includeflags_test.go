@@ -0,0 +1,107 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+package cc2ce
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestIncludeDirsFromArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []IncludeDir
+	}{
+		{
+			name: "joined and separated",
+			args: []string{"g++", "-Ia", "-I", "b", "-isystemc", "-isystem", "d", "-iquote", "e", "-idirafter", "f", "-c", "x.cpp"},
+			want: []IncludeDir{
+				{"a", IncludeUser, "-I"},
+				{"b", IncludeUser, "-I"},
+				{"c", IncludeSystem, "-isystem"},
+				{"d", IncludeSystem, "-isystem"},
+				{"e", IncludeQuote, "-iquote"},
+				{"f", IncludeAfter, "-idirafter"},
+			},
+		},
+		{
+			name: "long forms",
+			args: []string{"g++", "--include-directory=g", "--include-directory-after=h"},
+			want: []IncludeDir{
+				{"g", IncludeUser, "--include-directory"},
+				{"h", IncludeAfter, "--include-directory-after"},
+			},
+		},
+		{
+			name: "sysroot relative",
+			args: []string{"g++", "-I=/usr/include", "-isystem", "$SYSROOT/opt", "--sysroot=/sr"},
+			want: []IncludeDir{
+				{"/sr/usr/include", IncludeUser, "-I"},
+				{"/sr/opt", IncludeSystem, "-isystem"},
+			},
+		},
+		{
+			name: "sysroot relative without sysroot",
+			args: []string{"g++", "-I=/usr/include"},
+			want: []IncludeDir{{"/usr/include", IncludeUser, "-I"}},
+		},
+		{
+			name: "isysroot wins for headers",
+			args: []string{"g++", "--sysroot", "/sr", "-isysroot", "/hsr", "-I=/inc"},
+			want: []IncludeDir{{"/hsr/inc", IncludeUser, "-I"}},
+		},
+		{
+			name: "prefix",
+			args: []string{"g++", "-iprefix", "/p/", "-iwithprefix", "i", "-iwithprefixbefore", "j"},
+			want: []IncludeDir{
+				{"/p/i", IncludeAfter, "-iwithprefix"},
+				{"/p/j", IncludeUser, "-iwithprefixbefore"},
+			},
+		},
+		{
+			name: "I- turns preceding -I into -iquote",
+			args: []string{"g++", "-Ia", "-isystem", "s", "-I-", "-Ib"},
+			want: []IncludeDir{
+				{"a", IncludeQuote, "-I"},
+				{"s", IncludeSystem, "-isystem"},
+				{"b", IncludeUser, "-I"},
+			},
+		},
+		{
+			name: "forced includes are no directories",
+			args: []string{"g++", "-include", "x.h", "-imacros", "y.h", "-Ia"},
+			want: []IncludeDir{{"a", IncludeUser, "-I"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := IncludeDirsFromArgs(tt.args)
+			if err != nil {
+				t.Fatalf("IncludeDirsFromArgs() error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("IncludeDirsFromArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIncludeDirsFromArgsDangling(t *testing.T) {
+	_, err := IncludeDirsFromArgs([]string{"g++", "-c", "x.cpp", "-isystem"})
+	var dangling *DanglingArgumentError
+	if !errors.As(err, &dangling) || dangling.Flag != "-isystem" {
+		t.Errorf("IncludeDirsFromArgs() error = %v, want missing argument to -isystem", err)
+	}
+}
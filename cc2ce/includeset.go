@@ -0,0 +1,103 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+package cc2ce
+
+import (
+	"sort"
+	"strings"
+)
+
+// IncludePath is an entry of an IncludeSet.
+//   - Kind is the kind of the first occurrence of the path
+//   - Uses is the number of translation units which use the path
+type IncludePath struct {
+	Path string
+	Kind IncludeKind
+	Uses int
+}
+
+// IncludeSet is an ordered set of include paths. Unlike a map[string]bool,
+// it remembers in which order paths were first seen, such that the search
+// order (and with it which of several headers of the same name gets found)
+// is the same every time a configuration gets generated.
+//
+// The zero value is an empty set ready to use.
+type IncludeSet struct {
+	paths []IncludePath
+	index map[string]int
+}
+
+// Add inserts a path. If the path is already present, only the usage count
+// gets increased, the kind and position of the first occurrence are kept.
+func (s *IncludeSet) Add(p IncludePath) {
+	if s.index == nil {
+		s.index = make(map[string]int)
+	}
+	if i, found := s.index[p.Path]; found {
+		s.paths[i].Uses += p.Uses
+		return
+	}
+	s.index[p.Path] = len(s.paths)
+	s.paths = append(s.paths, p)
+}
+
+// AddTranslationUnit inserts the include paths of one translation unit. A
+// path that occurs several times on the same command line counts as one use.
+func (s *IncludeSet) AddTranslationUnit(dirs []IncludeDir) {
+	seen := make(map[string]bool)
+	for _, d := range dirs {
+		if seen[d.Path] {
+			continue
+		}
+		seen[d.Path] = true
+		s.Add(IncludePath{Path: d.Path, Kind: d.Kind, Uses: 1})
+	}
+}
+
+// Contains tells if the path is in the set.
+func (s *IncludeSet) Contains(path string) bool {
+	_, found := s.index[path]
+	return found
+}
+
+// Len returns the number of paths in the set.
+func (s *IncludeSet) Len() int {
+	return len(s.paths)
+}
+
+// Entries returns the paths in the order in which the compiler would search
+// them: first grouped by kind (quote, user, system, after), then in the order
+// in which they were first seen.
+func (s *IncludeSet) Entries() []IncludePath {
+	entries := make([]IncludePath, len(s.paths))
+	copy(entries, s.paths)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Kind < entries[j].Kind
+	})
+	return entries
+}
+
+// Paths returns the paths in search order (see Entries).
+func (s *IncludeSet) Paths() []string {
+	var paths []string
+	for _, p := range s.Entries() {
+		paths = append(paths, p.Path)
+	}
+	return paths
+}
+
+// ColonSeparated returns the paths in search order (see Entries) as colon
+// separated string, as needed for the path= setting of a library.
+func (s *IncludeSet) ColonSeparated() string {
+	return strings.Join(s.Paths(), ":")
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+package cc2ce
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIncludeSetEntries(t *testing.T) {
+	tests := []struct {
+		name  string
+		calls [][]string
+		want  []IncludePath
+	}{
+		{
+			name: "first seen order",
+			calls: [][]string{
+				{"g++", "-I/c", "-I/a"},
+				{"g++", "-I/b", "-I/a", "-I/c"},
+			},
+			want: []IncludePath{
+				{Path: "/c", Kind: IncludeUser, Uses: 2},
+				{Path: "/a", Kind: IncludeUser, Uses: 2},
+				{Path: "/b", Kind: IncludeUser, Uses: 1},
+			},
+		},
+		{
+			name: "grouped by kind",
+			calls: [][]string{
+				{"g++", "-isystem", "/sys", "-I/user", "-idirafter", "/after", "-iquote", "/quote"},
+				{"g++", "-isystem/sys2", "-iquote/quote2", "-I", "/user2"},
+			},
+			want: []IncludePath{
+				{Path: "/quote", Kind: IncludeQuote, Uses: 1},
+				{Path: "/quote2", Kind: IncludeQuote, Uses: 1},
+				{Path: "/user", Kind: IncludeUser, Uses: 1},
+				{Path: "/user2", Kind: IncludeUser, Uses: 1},
+				{Path: "/sys", Kind: IncludeSystem, Uses: 1},
+				{Path: "/sys2", Kind: IncludeSystem, Uses: 1},
+				{Path: "/after", Kind: IncludeAfter, Uses: 1},
+			},
+		},
+		{
+			name: "the first kind of a path is kept",
+			calls: [][]string{
+				{"g++", "-isystem", "/x", "-I/y"},
+				{"g++", "-I/x", "-iquote/y"},
+			},
+			want: []IncludePath{
+				{Path: "/y", Kind: IncludeUser, Uses: 2},
+				{Path: "/x", Kind: IncludeSystem, Uses: 2},
+			},
+		},
+		{
+			name: "one use per translation unit",
+			calls: [][]string{
+				{"g++", "-I/a", "-I/a", "-isystem", "/a"},
+				{"g++", "-I/a"},
+				{"g++", "-I/b"},
+			},
+			want: []IncludePath{
+				{Path: "/a", Kind: IncludeUser, Uses: 2},
+				{Path: "/b", Kind: IncludeUser, Uses: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		var s IncludeSet
+		for _, call := range tt.calls {
+			dirs, err := IncludeDirsFromArgs(call)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			s.AddTranslationUnit(dirs)
+		}
+		if got := s.Entries(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+		if s.Len() != len(tt.want) {
+			t.Errorf("%s: got length %d, want %d", tt.name, s.Len(), len(tt.want))
+		}
+	}
+}
+
+func TestIncludeSetAdd(t *testing.T) {
+	var s IncludeSet
+	if s.Contains("/a") || s.Len() != 0 || s.Paths() != nil || s.ColonSeparated() != "" {
+		t.Errorf("zero value isn't empty: %+v", s.Entries())
+	}
+	s.Add(IncludePath{Path: "/a", Kind: IncludeSystem, Uses: 3})
+	s.Add(IncludePath{Path: "/b", Kind: IncludeUser, Uses: 1})
+	s.Add(IncludePath{Path: "/a", Kind: IncludeUser, Uses: 2})
+	want := []IncludePath{
+		{Path: "/b", Kind: IncludeUser, Uses: 1},
+		{Path: "/a", Kind: IncludeSystem, Uses: 5},
+	}
+	if got := s.Entries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if !s.Contains("/a") || s.Contains("/c") {
+		t.Errorf("got contains /a %v, /c %v", s.Contains("/a"), s.Contains("/c"))
+	}
+	if got := s.ColonSeparated(); got != "/b:/a" {
+		t.Errorf("got %q, want /b:/a", got)
+	}
+
+	// the entries are a copy
+	s.Entries()[0].Uses = 100
+	if got := s.Entries()[0].Uses; got != 1 {
+		t.Errorf("changing the entries changed the set: got %d uses", got)
+	}
+}
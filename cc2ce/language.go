@@ -0,0 +1,124 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+// This file contains the classification of translation units by language,
+// as Compiler Explorer configures each language in its own file
+// (c++.local.properties, c.local.properties, ...).
+
+package cc2ce
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// The languages of Compiler Explorer that translation units are sorted into.
+const (
+	LanguageCpp     = "c++"
+	LanguageC       = "c"
+	LanguageCuda    = "cuda"
+	LanguageFortran = "fortran"
+)
+
+// Languages are all languages translation units are sorted into.
+var Languages = []string{LanguageCpp, LanguageC, LanguageCuda, LanguageFortran}
+
+// xLanguages maps the arguments of -x to languages.
+var xLanguages = map[string]string{
+	"c":                  LanguageC,
+	"c-header":           LanguageC,
+	"cpp-output":         LanguageC,
+	"c++":                LanguageCpp,
+	"c++-header":         LanguageCpp,
+	"c++-cpp-output":     LanguageCpp,
+	"cuda":               LanguageCuda,
+	"cu":                 LanguageCuda,
+	"f77":                LanguageFortran,
+	"f77-cpp-input":      LanguageFortran,
+	"f95":                LanguageFortran,
+	"f95-cpp-input":      LanguageFortran,
+	"fortran":            LanguageFortran,
+	"assembler":          "",
+	"assembler-with-cpp": "",
+}
+
+// extensionLanguages maps file extensions to languages. Extensions not
+// listed are C++.
+var extensionLanguages = map[string]string{
+	".c":   LanguageC,
+	".cu":  LanguageCuda,
+	".f":   LanguageFortran,
+	".for": LanguageFortran,
+	".f77": LanguageFortran,
+	".f90": LanguageFortran,
+	".f95": LanguageFortran,
+	".f03": LanguageFortran,
+	".f08": LanguageFortran,
+}
+
+// SourceLanguage returns the language of the compiled file: the one given
+// with -x if any, otherwise the one of the file extension (where .F90 is
+// Fortran like .f90, but .C is C++ unlike .c). Anything unknown is C++.
+func (cc CompileCommand) SourceLanguage() string {
+	if language, found := xLanguages[cc.Language]; found && language != "" {
+		return language
+	}
+	ext := filepath.Ext(cc.File)
+	if language, found := extensionLanguages[ext]; found {
+		return language
+	}
+	if ext != ".C" {
+		if language, found := extensionLanguages[strings.ToLower(ext)]; found && language == LanguageFortran {
+			return language
+		}
+	}
+	return LanguageCpp
+}
+
+// LanguageGroup are the translation units of one language.
+type LanguageGroup struct {
+	Language string
+	Commands []CompileCommand
+}
+
+// GroupByLanguage sorts compiler calls by their language (see
+// SourceLanguage). Groups are in the order in which their language first
+// occurs.
+func GroupByLanguage(cmds []CompileCommand) []LanguageGroup {
+	var groups []LanguageGroup
+	index := make(map[string]int)
+	for _, cc := range cmds {
+		language := cc.SourceLanguage()
+		if i, found := index[language]; found {
+			groups[i].Commands = append(groups[i].Commands, cc)
+			continue
+		}
+		index[language] = len(groups)
+		groups = append(groups, LanguageGroup{Language: language, Commands: []CompileCommand{cc}})
+	}
+	return groups
+}
+
+// LanguageFilename returns the name of the properties file of a language,
+// derived from the one of C++: c++.local.properties becomes
+// c.local.properties for C. Names not starting with "c++." get the language
+// prefixed for languages other than C++.
+func LanguageFilename(cppFilename string, language string) string {
+	if language == LanguageCpp {
+		return cppFilename
+	}
+	dir, base := filepath.Split(cppFilename)
+	if strings.HasPrefix(base, LanguageCpp+".") {
+		return filepath.Join(dir, language+base[len(LanguageCpp):])
+	}
+	return filepath.Join(dir, language+"."+base)
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+package cc2ce
+
+import (
+	"testing"
+)
+
+func TestSourceLanguageOfFiles(t *testing.T) {
+	tests := []struct {
+		file     string
+		language string
+		want     string
+	}{
+		{file: "a.cpp", want: LanguageCpp},
+		{file: "a.cc", want: LanguageCpp},
+		{file: "a.C", want: LanguageCpp},
+		{file: "a.c", want: LanguageC},
+		{file: "a.cu", want: LanguageCuda},
+		{file: "a.f90", want: LanguageFortran},
+		{file: "a.F90", want: LanguageFortran},
+		{file: "a.F", want: LanguageFortran},
+		{file: "a.hpp", want: LanguageCpp},
+		{file: "a.unknown", want: LanguageCpp},
+		// -x takes precedence over the extension
+		{file: "a.cpp", language: "c", want: LanguageC},
+		{file: "a.h", language: "c-header", want: LanguageC},
+		{file: "a.c", language: "c++", want: LanguageCpp},
+		{file: "a.cu", language: "cuda", want: LanguageCuda},
+		{file: "a.inc", language: "f95-cpp-input", want: LanguageFortran},
+		// assembler goes by the extension
+		{file: "a.c", language: "assembler", want: LanguageC},
+	}
+	for _, tt := range tests {
+		got := CompileCommand{File: tt.file, Language: tt.language}.SourceLanguage()
+		if got != tt.want {
+			t.Errorf("%s (-x %q): got %s, want %s", tt.file, tt.language, got, tt.want)
+		}
+	}
+}
+
+func TestLanguageFilename(t *testing.T) {
+	tests := []struct {
+		cpp, language, want string
+	}{
+		{"c++.local.properties", LanguageCpp, "c++.local.properties"},
+		{"c++.local.properties", LanguageC, "c.local.properties"},
+		{"/etc/ce/c++.local.properties", LanguageFortran, "/etc/ce/fortran.local.properties"},
+		{"/etc/ce/mine.properties", LanguageCuda, "/etc/ce/cuda.mine.properties"},
+	}
+	for _, tt := range tests {
+		if got := LanguageFilename(tt.cpp, tt.language); got != tt.want {
+			t.Errorf("LanguageFilename(%q, %q) = %q, want %q", tt.cpp, tt.language, got, tt.want)
+		}
+	}
+}
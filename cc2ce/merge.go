@@ -0,0 +1,144 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+// This file contains the merging of several compilation databases (e.g. from
+// several CMake build trees of one project) into one.
+
+package cc2ce
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// DatabaseContribution describes what one database contributed to a merge.
+//   - Entries is the number of translation units taken from the database
+//   - Duplicates is the number of entries that were already present with
+//     the same compiler call in an earlier database
+//   - Conflicts is the number of entries that were already present with a
+//     different compiler call in an earlier database (the earlier one wins)
+//   - Includes are the include paths of the entries taken from the database
+type DatabaseContribution struct {
+	Path       string
+	Entries    int
+	Duplicates int
+	Conflicts  int
+	Includes   IncludeSet
+}
+
+// MergeReport lists the contribution of each database to a merge, in the
+// order in which the databases were merged.
+type MergeReport struct {
+	Databases []DatabaseContribution
+}
+
+func (r MergeReport) String() string {
+	var lines []string
+	for _, d := range r.Databases {
+		lines = append(lines, fmt.Sprintf("%s: %d entries (%d duplicates, %d conflicts), include paths: %s",
+			d.Path, d.Entries, d.Duplicates, d.Conflicts, d.Includes.ColonSeparated()))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ExpandDatabasePaths turns a list of database paths and glob patterns into
+// a list of databases (see OpenDatabase for what they can be). Patterns
+// without match are kept as they are, such that opening them reports a
+// meaningful error (or reads stdin for "-").
+func ExpandDatabasePaths(patterns []string) ([]string, error) {
+	var paths []string
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return paths, fmt.Errorf("invalid database pattern %s: %v", pattern, err)
+		}
+		if len(matches) == 0 {
+			matches = []string{pattern}
+		}
+		for _, m := range matches {
+			if !seen[m] {
+				paths = append(paths, m)
+			}
+			seen[m] = true
+		}
+	}
+	return paths, nil
+}
+
+// entryKey identifies a translation unit across databases: the same file
+// compiled in the same directory to the same output.
+func entryKey(tu JsonTranslationunit) string {
+	file := tu.File
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(tu.Builddir, file)
+	}
+	return strings.Join([]string{filepath.Clean(tu.Builddir), filepath.Clean(file), tu.Output}, "\x00")
+}
+
+// MergeDatabases reads the databases at paths (see ExpandDatabasePaths) and
+// merges them into one. Entries for the same file, build directory and
+// output are only taken from the first database that has them. Within one
+// database, all entries are taken, as a file can legitimately be compiled
+// more than once (e.g. for several targets).
+//
+// When turnAbsolute is true, the include paths in the report are turned
+// absolute (see IncludesFromJsonByBytes).
+func MergeDatabases(paths []string, turnAbsolute bool) ([]JsonTranslationunit, MergeReport, error) {
+	var merged []JsonTranslationunit
+	var report MergeReport
+	// the compiler calls of each entry key in the earlier databases
+	calls := make(map[string]map[string]bool)
+
+	for _, path := range paths {
+		db, err := JsonTUsByFilename(path)
+		if err != nil {
+			return merged, report, fmt.Errorf("%s: %w", path, err)
+		}
+		contribution := DatabaseContribution{Path: path}
+		own := make(map[string]map[string]bool)
+		for _, tu := range db {
+			argv, err := tu.Argv()
+			if err != nil {
+				return merged, report, fmt.Errorf("%s: %s: %w", path, tu.File, err)
+			}
+			call := strings.Join(argv, "\x00")
+			key := entryKey(tu)
+			if previous, found := calls[key]; found {
+				if previous[call] {
+					contribution.Duplicates++
+				} else {
+					contribution.Conflicts++
+				}
+				continue
+			}
+			if own[key] == nil {
+				own[key] = make(map[string]bool)
+			}
+			own[key][call] = true
+
+			cc, err := ParseCompileCommand(tu)
+			if err != nil {
+				return merged, report, fmt.Errorf("%s: %s: %w", path, tu.File, err)
+			}
+			contribution.Includes.AddTranslationUnit(cc.IncludePaths(turnAbsolute))
+			contribution.Entries++
+			merged = append(merged, tu)
+		}
+		for key, c := range own {
+			calls[key] = c
+		}
+		report.Databases = append(report.Databases, contribution)
+	}
+	return merged, report, nil
+}
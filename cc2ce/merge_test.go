@@ -0,0 +1,68 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+package cc2ce
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestMergeDatabases(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.json")
+	second := filepath.Join(dir, "second.json")
+	// a.cpp is compiled twice in the first database, for two targets
+	content := map[string]string{
+		first: `[
+  {"directory": "/b", "file": "a.cpp", "command": "g++ -I/x -c a.cpp"},
+  {"directory": "/b", "file": "a.cpp", "command": "g++ -I/x -fPIC -c a.cpp"},
+  {"directory": "/b", "file": "b.cpp", "command": "g++ -I/x -c b.cpp"}
+]`,
+		second: `[
+  {"directory": "/b", "file": "a.cpp", "command": "g++ -I/x -fPIC -c a.cpp"},
+  {"directory": "/b", "file": "/b/b.cpp", "command": "g++ -I/z -c b.cpp"},
+  {"directory": "/b", "file": "c.cpp", "command": "g++ -I/y -c c.cpp"},
+  {"directory": "/b", "file": "c.cpp", "command": "g++ -I/y -O2 -c c.cpp"}
+]`,
+	}
+	for name, c := range content {
+		if err := ioutil.WriteFile(name, []byte(c), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	merged, report, err := MergeDatabases([]string{first, second}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merged) != 5 {
+		t.Errorf("got %d merged entries, want 5", len(merged))
+	}
+	want := []DatabaseContribution{
+		{Path: first, Entries: 3},
+		{Path: second, Entries: 2, Duplicates: 1, Conflicts: 1},
+	}
+	if len(report.Databases) != len(want) {
+		t.Fatalf("got %d databases in the report", len(report.Databases))
+	}
+	for i, w := range want {
+		got := report.Databases[i]
+		if got.Path != w.Path || got.Entries != w.Entries || got.Duplicates != w.Duplicates || got.Conflicts != w.Conflicts {
+			t.Errorf("database %d: got %+v, want %+v", i, got, w)
+		}
+	}
+	if got := report.Databases[1].Includes.ColonSeparated(); got != "/y" {
+		t.Errorf("got include paths %q of the second database, want /y", got)
+	}
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+// This file contains the reading of Meson's introspection files
+// (meson-info/intro-targets.json and intro-compilers.json).
+
+package cc2ce
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const mesonInfoName = "meson-info"
+const mesonTargetsName = "intro-targets.json"
+const mesonCompilersName = "intro-compilers.json"
+
+// MesonTarget is a target of a Meson build, with include paths and options
+// as IncludesFromJsonByDB and OptionsFromJsonByDB return them for the
+// target's translation units.
+type MesonTarget struct {
+	Name     string
+	Type     string // e.g. "shared library" or "executable"
+	Compiler string // compiler call of the first source of the target
+	Includes IncludeSet
+	Options  string
+}
+
+// MesonIntrospection is the content of the meson-info directory of a build
+// directory. TranslationUnits can be processed like a compilation database.
+// Compilers maps languages (as Meson names them, e.g. "cpp") to the
+// compiler call for the host machine.
+type MesonIntrospection struct {
+	BuildDir         string
+	Compilers        map[string]string
+	TranslationUnits []JsonTranslationunit
+	Targets          []MesonTarget
+}
+
+type mesonTargetReply struct {
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	TargetSources []struct {
+		Language         string   `json:"language"`
+		Compiler         []string `json:"compiler"`
+		Parameters       []string `json:"parameters"`
+		Sources          []string `json:"sources"`
+		GeneratedSources []string `json:"generated_sources"`
+	} `json:"target_sources"`
+}
+
+type mesonCompilerReply struct {
+	Exelist []string `json:"exelist"`
+}
+
+// mesonInfoDir tells if inFileName refers to Meson introspection files:
+// either the meson-info directory or intro-targets.json in it, or a build
+// directory that contains meson-info but no compilation database (which
+// Meson usually writes as well).
+func mesonInfoDir(inFileName string) (string, bool) {
+	if filepath.Base(inFileName) == mesonTargetsName {
+		return filepath.Dir(inFileName), true
+	}
+	info, err := os.Stat(inFileName)
+	if err != nil || !info.IsDir() {
+		return "", false
+	}
+	if _, err := os.Stat(filepath.Join(inFileName, mesonTargetsName)); err == nil {
+		return inFileName, true
+	}
+	for _, n := range databaseNames {
+		if _, err := os.Stat(filepath.Join(inFileName, n)); err == nil {
+			return "", false
+		}
+	}
+	candidate := filepath.Join(inFileName, mesonInfoName)
+	if _, err := os.Stat(filepath.Join(candidate, mesonTargetsName)); err == nil {
+		return candidate, true
+	}
+	return "", false
+}
+
+// MesonIntrospectionByDirectory reads the introspection files of a Meson
+// build directory (or its meson-info directory). Meson runs the compiler in
+// the build directory, relative paths in the options are relative to it.
+//
+// intro-compilers.json is optional, Compilers is empty without it.
+func MesonIntrospectionByDirectory(dir string) (MesonIntrospection, error) {
+	infoDir := dir
+	if _, err := os.Stat(filepath.Join(dir, mesonTargetsName)); err != nil {
+		infoDir = filepath.Join(dir, mesonInfoName)
+	}
+	var intro MesonIntrospection
+	buildDir, err := filepath.Abs(filepath.Dir(infoDir))
+	if err != nil {
+		return intro, err
+	}
+	intro.BuildDir = buildDir
+	intro.Compilers = make(map[string]string)
+
+	var compilers map[string]map[string]mesonCompilerReply
+	if content, err := ioutil.ReadFile(filepath.Join(infoDir, mesonCompilersName)); err == nil {
+		if err := json.Unmarshal(content, &compilers); err != nil {
+			return intro, fmt.Errorf("%s: %v", mesonCompilersName, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return intro, err
+	}
+	for language, c := range compilers["host"] {
+		intro.Compilers[language] = JoinArguments(c.Exelist)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(infoDir, mesonTargetsName))
+	if err != nil {
+		return intro, err
+	}
+	var targets []mesonTargetReply
+	if err := json.Unmarshal(content, &targets); err != nil {
+		return intro, fmt.Errorf("%s: %v", mesonTargetsName, err)
+	}
+
+	for _, t := range targets {
+		var tus []JsonTranslationunit
+		for _, group := range t.TargetSources {
+			compiler := group.Compiler
+			sources := append(append([]string{}, group.Sources...), group.GeneratedSources...)
+			if len(compiler) == 0 {
+				if len(sources) == 0 {
+					// the linker entry of Meson 1.2 and later
+					continue
+				}
+				return intro, fmt.Errorf("target %s: no compiler for %s sources", t.Name, group.Language)
+			}
+			for _, source := range sources {
+				args := append(append(append([]string{}, compiler...), group.Parameters...), "-c", source)
+				tus = append(tus, JsonTranslationunit{Builddir: buildDir, File: source, Arguments: args})
+			}
+		}
+		target := MesonTarget{Name: t.Name, Type: t.Type}
+		if len(tus) != 0 {
+			cmds, err := CompileCommandsFromDB(tus)
+			if err != nil {
+				return intro, fmt.Errorf("target %s: %w", t.Name, err)
+			}
+			target.Compiler = cmds[0].CompilerCall()
+			target.Includes = IncludesFromCommands(cmds, true)
+			target.Options, err = OptionsFromCommands(cmds, false)
+			if err != nil {
+				return intro, fmt.Errorf("target %s: %w", t.Name, err)
+			}
+		}
+		intro.TranslationUnits = append(intro.TranslationUnits, tus...)
+		intro.Targets = append(intro.Targets, target)
+	}
+	return intro, nil
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+package cc2ce
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeMesonInfo creates a build directory with intro-targets.json.
+func writeMesonInfo(t *testing.T, targets string) string {
+	dir := t.TempDir()
+	infoDir := filepath.Join(dir, mesonInfoName)
+	if err := os.Mkdir(infoDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(infoDir, mesonTargetsName), []byte(targets), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestMesonLinkerEntries(t *testing.T) {
+	// Meson 1.2 and later list the linker of a target among its sources
+	dir := writeMesonInfo(t, `[
+  {
+    "name": "foo",
+    "type": "shared library",
+    "target_sources": [
+      {
+        "language": "cpp",
+        "compiler": ["c++"],
+        "parameters": ["-std=c++17", "-O2"],
+        "sources": ["/src/a.cpp"],
+        "generated_sources": []
+      },
+      {
+        "linker": ["c++"],
+        "parameters": ["-shared", "-Wl,--as-needed"]
+      }
+    ]
+  }
+]`)
+	intro, err := MesonIntrospectionByDirectory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(intro.TranslationUnits) != 1 || intro.TranslationUnits[0].File != "/src/a.cpp" {
+		t.Errorf("got translation units %+v", intro.TranslationUnits)
+	}
+	if len(intro.Targets) != 1 || intro.Targets[0].Options != "-std=c++17 -O2" {
+		t.Errorf("got targets %+v", intro.Targets)
+	}
+}
+
+func TestMesonSourcesWithoutCompiler(t *testing.T) {
+	dir := writeMesonInfo(t, `[
+  {
+    "name": "foo",
+    "type": "executable",
+    "target_sources": [
+      {"language": "cpp", "compiler": [], "parameters": [], "sources": ["/src/a.cpp"]}
+    ]
+  }
+]`)
+	if _, err := MesonIntrospectionByDirectory(dir); err == nil {
+		t.Error("no error for sources without compiler")
+	}
+}
@@ -0,0 +1,261 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+// This file contains the opening of a compilation database from wherever CI
+// puts it: a plain file, stdin, a compressed file, or a file inside a build
+// artifact archive.
+
+package cc2ce
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// databaseNames are the file names looked for in a directory or archive, in
+// order of preference.
+var databaseNames = []string{
+	"compile_commands.json",
+	"compile_commands.json.gz",
+	"compile_commands.json.zst",
+	"compile_commands.json.xz",
+}
+
+// archiveSuffixes are the file name endings of archives that can contain a
+// compilation database.
+var archiveSuffixes = []string{".tar", ".tar.gz", ".tgz", ".tar.zst", ".tar.xz", ".zip"}
+
+// readCloser combines a reader with the cleanup of everything it reads
+// from.
+type readCloser struct {
+	io.Reader
+	closers []func() error
+}
+
+func (r *readCloser) Close() error {
+	var first error
+	for i := len(r.closers) - 1; i >= 0; i-- {
+		if err := r.closers[i](); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// decompress detects gzip, zstd and xz compression by their magic bytes and
+// returns a decompressing reader. Uncompressed input is returned as is.
+func decompress(r io.Reader) (io.Reader, func() error, error) {
+	nothing := func() error { return nil }
+	buffered := bufio.NewReader(r)
+	magic, _ := buffered.Peek(6)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, nothing, err
+		}
+		return gz, gz.Close, nil
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		zr, err := zstd.NewReader(buffered)
+		if err != nil {
+			return nil, nothing, err
+		}
+		return zr, func() error { zr.Close(); return nil }, nil
+	case bytes.HasPrefix(magic, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}):
+		xr, err := xz.NewReader(buffered)
+		if err != nil {
+			return nil, nothing, err
+		}
+		return xr, nothing, nil
+	}
+	return buffered, nothing, nil
+}
+
+// isDatabaseName tells if an archive member should be taken as database
+// when no member name was given.
+func isDatabaseName(name string) bool {
+	for _, n := range databaseNames {
+		if path.Base(name) == n {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesMember tells if the archive member name is the requested one. An
+// empty request matches any database file, a request naming a directory
+// matches a database file in that directory.
+func matchesMember(name, member string) bool {
+	name = path.Clean(strings.TrimPrefix(name, "./"))
+	if member == "" {
+		return isDatabaseName(name)
+	}
+	member = path.Clean(strings.TrimPrefix(member, "./"))
+	if name == member {
+		return true
+	}
+	return path.Dir(name) == member && isDatabaseName(name)
+}
+
+// splitArchivePath finds an archive file among the leading components of
+// name, e.g. "artifacts.tar.gz/build/compile_commands.json" is split into
+// "artifacts.tar.gz" and "build/compile_commands.json".
+func splitArchivePath(name string) (string, string, bool) {
+	components := strings.Split(filepath.ToSlash(name), "/")
+	for i := range components {
+		candidate := filepath.FromSlash(strings.Join(components[:i+1], "/"))
+		if candidate == "" {
+			continue
+		}
+		isarchive := false
+		for _, suffix := range archiveSuffixes {
+			if strings.HasSuffix(candidate, suffix) {
+				isarchive = true
+			}
+		}
+		if !isarchive {
+			continue
+		}
+		if info, err := os.Stat(candidate); err == nil && info.Mode().IsRegular() {
+			return candidate, strings.Join(components[i+1:], "/"), true
+		}
+	}
+	return "", "", false
+}
+
+func openFromZip(archive, member string) (io.ReadCloser, error) {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || !matchesMember(f.Name, member) {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			zr.Close()
+			return nil, err
+		}
+		r, closer, err := decompress(rc)
+		if err != nil {
+			rc.Close()
+			zr.Close()
+			return nil, err
+		}
+		return &readCloser{Reader: r, closers: []func() error{zr.Close, rc.Close, closer}}, nil
+	}
+	zr.Close()
+	return nil, &os.PathError{Op: "open", Path: path.Join(filepath.ToSlash(archive), member), Err: os.ErrNotExist}
+}
+
+func openFromTar(archive, member string) (io.ReadCloser, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	r, closer, err := decompress(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			closer()
+			f.Close()
+			return nil, fmt.Errorf("reading %s: %w", archive, err)
+		}
+		if hdr.Typeflag != tar.TypeReg || !matchesMember(hdr.Name, member) {
+			continue
+		}
+		inner, innercloser, err := decompress(tr)
+		if err != nil {
+			closer()
+			f.Close()
+			return nil, err
+		}
+		return &readCloser{Reader: inner, closers: []func() error{f.Close, closer, innercloser}}, nil
+	}
+	closer()
+	f.Close()
+	return nil, &os.PathError{Op: "open", Path: path.Join(filepath.ToSlash(archive), member), Err: os.ErrNotExist}
+}
+
+// OpenDatabase opens a compilation database for reading. The name can be
+//   - "-" for stdin
+//   - a compile_commands.json file, possibly compressed with gzip, zstd or
+//     xz (detected from the content, not the file name)
+//   - a directory containing compile_commands.json (or a compressed
+//     compile_commands.json.gz, .zst, or .xz)
+//   - a path inside a .tar, .tar.gz, .tgz, .tar.zst, .tar.xz or .zip
+//     archive, such as artifacts.tar.gz/build/compile_commands.json. If the
+//     path inside the archive is a directory or empty, the database is
+//     looked for in that directory or anywhere in the archive.
+//
+// Errors for files that don't exist satisfy os.IsNotExist.
+func OpenDatabase(name string) (io.ReadCloser, error) {
+	if name == "-" {
+		r, closer, err := decompress(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		return &readCloser{Reader: r, closers: []func() error{closer}}, nil
+	}
+
+	if archive, member, found := splitArchivePath(name); found {
+		if strings.HasSuffix(archive, ".zip") {
+			return openFromZip(archive, member)
+		}
+		return openFromTar(archive, member)
+	}
+
+	if info, err := os.Stat(name); err == nil && info.IsDir() {
+		found := false
+		for _, n := range databaseNames {
+			if _, err := os.Stat(filepath.Join(name, n)); err == nil {
+				name = filepath.Join(name, n)
+				found = true
+				break
+			}
+		}
+		if !found {
+			name = filepath.Join(name, databaseNames[0])
+		}
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	r, closer, err := decompress(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &readCloser{Reader: r, closers: []func() error{f.Close, closer}}, nil
+}
@@ -0,0 +1,231 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+package cc2ce
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+const openTestDatabase = `[{"directory": "/b", "file": "a.cpp", "command": "g++ -I/x -c a.cpp"}]`
+
+// compressions compress content in the formats OpenDatabase detects.
+var compressions = map[string]func(t *testing.T, content []byte) []byte{
+	"none": func(t *testing.T, content []byte) []byte {
+		return content
+	},
+	"gzip": func(t *testing.T, content []byte) []byte {
+		var b bytes.Buffer
+		w := gzip.NewWriter(&b)
+		closeCompressor(t, w, content)
+		return b.Bytes()
+	},
+	"zstd": func(t *testing.T, content []byte) []byte {
+		var b bytes.Buffer
+		w, err := zstd.NewWriter(&b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		closeCompressor(t, w, content)
+		return b.Bytes()
+	},
+	"xz": func(t *testing.T, content []byte) []byte {
+		var b bytes.Buffer
+		w, err := xz.NewWriter(&b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		closeCompressor(t, w, content)
+		return b.Bytes()
+	},
+}
+
+func closeCompressor(t *testing.T, w io.WriteCloser, content []byte) {
+	if _, err := w.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readDatabase opens a database with OpenDatabase and reads it.
+func readDatabase(t *testing.T, name string) (string, error) {
+	r, err := OpenDatabase(name)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	content, err := ioutil.ReadAll(r)
+	return string(content), err
+}
+
+func TestOpenDatabaseCompressed(t *testing.T) {
+	for format, compress := range compressions {
+		dir := t.TempDir()
+		// detected by content, whatever the name
+		name := filepath.Join(dir, "compile_commands.json")
+		if err := ioutil.WriteFile(name, compress(t, []byte(openTestDatabase)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range []string{name, dir} {
+			got, err := readDatabase(t, n)
+			if err != nil {
+				t.Errorf("%s: %s: %v", format, n, err)
+			} else if got != openTestDatabase {
+				t.Errorf("%s: %s: got %q", format, n, got)
+			}
+		}
+	}
+}
+
+func TestOpenDatabaseCompressedInDirectory(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "compile_commands.json.zst"), compressions["zstd"](t, []byte(openTestDatabase)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := readDatabase(t, dir); err != nil || got != openTestDatabase {
+		t.Errorf("got %q, %v", got, err)
+	}
+}
+
+// archiveMembers are the files in the test archives.
+var archiveMembers = []struct {
+	name    string
+	content []byte
+}{
+	{"build/README", []byte("not a database")},
+	{"build/compile_commands.json", []byte(openTestDatabase)},
+	{"other/compile_commands.json", []byte(`[]`)},
+}
+
+func writeTar(t *testing.T, name string, compress func(*testing.T, []byte) []byte) {
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	for _, m := range archiveMembers {
+		if err := tw.WriteHeader(&tar.Header{Name: m.name, Mode: 0644, Size: int64(len(m.content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(m.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(name, compress(t, b.Bytes()), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeZip(t *testing.T, name string) {
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for _, m := range archiveMembers {
+		w, err := zw.Create(m.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(m.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(name, b.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenDatabaseInArchive(t *testing.T) {
+	dir := t.TempDir()
+	archives := map[string]func(string){
+		"artifacts.tar":     func(n string) { writeTar(t, n, compressions["none"]) },
+		"artifacts.tar.gz":  func(n string) { writeTar(t, n, compressions["gzip"]) },
+		"artifacts.tgz":     func(n string) { writeTar(t, n, compressions["gzip"]) },
+		"artifacts.tar.zst": func(n string) { writeTar(t, n, compressions["zstd"]) },
+		"artifacts.tar.xz":  func(n string) { writeTar(t, n, compressions["xz"]) },
+		"artifacts.zip":     func(n string) { writeZip(t, n) },
+	}
+	for archive, create := range archives {
+		name := filepath.Join(dir, archive)
+		create(name)
+		tests := []struct {
+			member string
+			want   string
+		}{
+			{"build/compile_commands.json", openTestDatabase},
+			{"./build/compile_commands.json", openTestDatabase},
+			{"build", openTestDatabase},
+			{"other", `[]`},
+			// the first database anywhere in the archive
+			{"", openTestDatabase},
+		}
+		for _, tt := range tests {
+			got, err := readDatabase(t, filepath.Join(name, tt.member))
+			if err != nil {
+				t.Errorf("%s/%s: %v", archive, tt.member, err)
+			} else if got != tt.want {
+				t.Errorf("%s/%s: got %q, want %q", archive, tt.member, got, tt.want)
+			}
+		}
+		for _, missing := range []string{"build/missing.json", "nowhere"} {
+			if _, err := readDatabase(t, filepath.Join(name, missing)); !os.IsNotExist(err) {
+				t.Errorf("%s/%s: got error %v, want one for a missing file", archive, missing, err)
+			}
+		}
+	}
+}
+
+func TestOpenDatabaseStdin(t *testing.T) {
+	for format, compress := range compressions {
+		f, err := ioutil.TempFile(t.TempDir(), "stdin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write(compress(t, []byte(openTestDatabase))); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		stdin := os.Stdin
+		os.Stdin = f
+		got, err := readDatabase(t, "-")
+		os.Stdin = stdin
+		f.Close()
+		if err != nil || got != openTestDatabase {
+			t.Errorf("%s: got %q, %v", format, got, err)
+		}
+	}
+}
+
+func TestOpenDatabaseMissing(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{filepath.Join(dir, "missing.json"), dir} {
+		if _, err := OpenDatabase(name); !os.IsNotExist(err) {
+			t.Errorf("%s: got error %v, want one for a missing file", name, err)
+		}
+	}
+}
@@ -14,27 +14,72 @@ package cc2ce
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"os"
+	"path/filepath"
 	"strings"
 
 	write "github.com/google/renameio"
 )
 
+// Library is a library for the drop-down of Compiler Explorer.
+//   - Paths are the include paths
+//   - Options are extra compiler options, e.g. the defines the library needs
+//   - LibPaths and LibLink are the link directories and the libraries to
+//     link (without -l), for libraries that aren't header-only
 type Library struct {
 	LibraryName    string
 	LibraryVersion string
 	LibraryUrl     string
-	Paths          map[string]bool
+	Paths          IncludeSet
+	Options        string
+	LibPaths       []string
+	LibLink        []string
 }
 
-func WriteSingleLibraryAndVersionToFile(lib Library, f *write.PendingFile) error {
-	if _, err := fmt.Fprintf(f, "libs=%s\n", strings.ToLower(lib.LibraryName)); err != nil {
+// propertyKey turns a library name or version into something usable as
+// part of a key in the CE configuration, where dots separate the parts of
+// the key, e.g. "gtk+-3.0" into "gtk_-3_0".
+func propertyKey(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' || r == '-' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+func WriteSingleLibraryAndVersionToFile(lib Library, f io.Writer) error {
+	return WriteLibrariesToFile([]Library{lib}, f)
+}
+
+// WriteLibrariesToFile writes several libraries (with one version each) to
+// the CE configuration.
+func WriteLibrariesToFile(libs []Library, f io.Writer) error {
+	var ids []string
+	for _, lib := range libs {
+		ids = append(ids, propertyKey(lib.LibraryName))
+	}
+	if _, err := fmt.Fprintf(f, "libs=%s\n", ColonSeparateArray(ids)); err != nil {
 		log.Printf("writing to c++.local.properties failed: %v", err)
 		return err
 	}
+	for _, lib := range libs {
+		if err := writeLibrary(lib, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
+func writeLibrary(lib Library, f io.Writer) error {
 	print_lib := func(key, val string) error {
-		if _, err := fmt.Fprintf(f, "libs.%s.%s=%s\n", strings.ToLower(lib.LibraryName), key, val); err != nil {
+		if _, err := fmt.Fprintf(f, "libs.%s.%s=%s\n", propertyKey(lib.LibraryName), key, val); err != nil {
 			log.Printf("writing to c++.local.properties failed: %v", err)
 			return err
 		}
@@ -51,13 +96,13 @@ func WriteSingleLibraryAndVersionToFile(lib Library, f *write.PendingFile) error
 			return err
 		}
 	}
-	err = print_lib("versions", lib.LibraryVersion)
+	err = print_lib("versions", propertyKey(lib.LibraryVersion))
 	if err != nil {
 		return err
 	}
 
 	print_lib_ver := func(key, val string) error {
-		if _, err := fmt.Fprintf(f, "libs.%s.versions.%s.%s=%s\n", strings.ToLower(lib.LibraryName), lib.LibraryVersion, key, val); err != nil {
+		if _, err := fmt.Fprintf(f, "libs.%s.versions.%s.%s=%s\n", propertyKey(lib.LibraryName), propertyKey(lib.LibraryVersion), key, val); err != nil {
 			log.Printf("writing to c++.local.properties failed: %v", err)
 			return err
 		}
@@ -67,10 +112,28 @@ func WriteSingleLibraryAndVersionToFile(lib Library, f *write.PendingFile) error
 	if err != nil {
 		return err
 	}
-	err = print_lib_ver("path", ColonSeparateMap(lib.Paths))
+	err = print_lib_ver("path", lib.Paths.ColonSeparated())
 	if err != nil {
 		return err
 	}
+	if lib.Options != "" {
+		err = print_lib_ver("options", lib.Options)
+		if err != nil {
+			return err
+		}
+	}
+	if len(lib.LibPaths) != 0 {
+		err = print_lib_ver("libpath", ColonSeparateArray(lib.LibPaths))
+		if err != nil {
+			return err
+		}
+	}
+	if len(lib.LibLink) != 0 {
+		err = print_lib_ver("liblink", ColonSeparateArray(lib.LibLink))
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -91,3 +154,134 @@ func WriteSingleLibraryAndVersion(lib Library) error {
 	}
 	return nil
 }
+
+// OutputSet writes several files of one directory (such as the properties
+// files of several languages) such that they are replaced atomically as one
+// set: readers see either all old or all new files, also if writing fails.
+//
+// For that, the files are symbolic links into a hidden directory next to
+// them (.<name>.d for the name the set was created with, see NewOutputSet).
+// Each set is written to a new directory in there, and the link "current"
+// is switched to it with a single rename on Commit. Files of the set that
+// don't exist yet are created as links before the switch (which dangle
+// until then, like a missing file). Existing regular files, such as those
+// of older versions of this program, can only be replaced by links after
+// the switch, one after another. The first commit over such files is thus
+// not atomic, all following ones are.
+type OutputSet struct {
+	dir        string
+	stage      string
+	generation string
+	files      []*os.File
+	names      []string
+	committed  bool
+}
+
+// NewOutputSet starts a set of files in the directory of name, where name
+// identifies the set (such as the C++ properties file), see OutputSet.
+func NewOutputSet(name string) (*OutputSet, error) {
+	s := &OutputSet{
+		dir:   filepath.Dir(name),
+		stage: filepath.Join(filepath.Dir(name), "."+filepath.Base(name)+".d"),
+	}
+	if err := os.MkdirAll(s.stage, 0755); err != nil {
+		return nil, err
+	}
+	generation, err := ioutil.TempDir(s.stage, "set-")
+	if err != nil {
+		return nil, err
+	}
+	// TempDir is only accessible to us, Compiler Explorer might run as
+	// someone else
+	if err := os.Chmod(generation, 0755); err != nil {
+		os.RemoveAll(generation)
+		return nil, err
+	}
+	s.generation = generation
+	return s, nil
+}
+
+// Create starts writing a file of the set, which must be in the directory
+// of the set.
+func (s *OutputSet) Create(name string) (io.Writer, error) {
+	if filepath.Dir(name) != s.dir {
+		return nil, fmt.Errorf("%s is not in the directory %s of the output set", name, s.dir)
+	}
+	for _, n := range s.names {
+		if filepath.Base(n) == filepath.Base(name) {
+			return nil, fmt.Errorf("%s is already part of the output set", name)
+		}
+	}
+	f, err := os.OpenFile(filepath.Join(s.generation, filepath.Base(name)), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		log.Printf("Couldn't create file for output writing: %v", err)
+		return nil, err
+	}
+	s.files = append(s.files, f)
+	s.names = append(s.names, name)
+	return f, nil
+}
+
+// Commit replaces the files of the set, see OutputSet.
+func (s *OutputSet) Commit() error {
+	for i, f := range s.files {
+		if err := f.Sync(); err != nil {
+			log.Printf("writing %s failed: %v", s.names[i], err)
+			return err
+		}
+		if err := f.Close(); err != nil {
+			log.Printf("writing %s failed: %v", s.names[i], err)
+			return err
+		}
+	}
+
+	current := filepath.Join(s.stage, "current")
+	previous, _ := os.Readlink(current)
+	var later []string
+	for _, name := range s.names {
+		target := filepath.Join(filepath.Base(s.stage), "current", filepath.Base(name))
+		if link, err := os.Readlink(name); err == nil && link == target {
+			continue
+		}
+		if _, err := os.Lstat(name); os.IsNotExist(err) {
+			if err := os.Symlink(target, name); err != nil {
+				log.Printf("writing %s failed: %v", name, err)
+				return err
+			}
+		} else if err != nil {
+			log.Printf("writing %s failed: %v", name, err)
+			return err
+		} else {
+			later = append(later, name)
+		}
+	}
+
+	if err := write.Symlink(filepath.Base(s.generation), current); err != nil {
+		log.Printf("switching %s failed: %v", current, err)
+		return err
+	}
+	s.committed = true
+	for _, name := range later {
+		target := filepath.Join(filepath.Base(s.stage), "current", filepath.Base(name))
+		if err := write.Symlink(target, name); err != nil {
+			log.Printf("writing %s failed: %v", name, err)
+			return err
+		}
+	}
+	if previous != "" && previous != filepath.Base(s.generation) {
+		os.RemoveAll(filepath.Join(s.stage, previous))
+	}
+	return nil
+}
+
+// Cleanup removes the files of a set that has not been committed, it can be
+// deferred right after creating the set.
+func (s *OutputSet) Cleanup() {
+	if s.committed {
+		return
+	}
+	for _, f := range s.files {
+		f.Close()
+	}
+	os.RemoveAll(s.generation)
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+package cc2ce
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeOutputSet writes files with the given content as one set, and
+// commits it if commit is set.
+func writeOutputSet(t *testing.T, setName string, content map[string]string, commit bool) {
+	s, err := NewOutputSet(setName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Cleanup()
+	for name, c := range content {
+		f, err := s.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fmt.Fprint(f, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if commit {
+		if err := s.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// checkContent checks the content of files, an empty string for a file
+// that must not exist.
+func checkContent(t *testing.T, when string, want map[string]string) {
+	for name, w := range want {
+		got, err := ioutil.ReadFile(name)
+		if w == "" {
+			if err == nil {
+				t.Errorf("%s: %s exists", when, name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", when, err)
+		} else if string(got) != w {
+			t.Errorf("%s: got %q in %s, want %q", when, got, name, w)
+		}
+	}
+}
+
+func TestOutputSet(t *testing.T) {
+	dir := t.TempDir()
+	cpp := filepath.Join(dir, "c++.local.properties")
+	c := filepath.Join(dir, "c.local.properties")
+
+	writeOutputSet(t, cpp, map[string]string{cpp: "cpp 1", c: "c 1"}, true)
+	checkContent(t, "first commit", map[string]string{cpp: "cpp 1", c: "c 1"})
+	for _, name := range []string{cpp, c} {
+		if info, err := os.Lstat(name); err != nil || info.Mode()&os.ModeSymlink == 0 {
+			t.Errorf("%s is not a link: %v", name, err)
+		}
+	}
+
+	// a set that fails before committing changes nothing
+	writeOutputSet(t, cpp, map[string]string{cpp: "cpp 2", c: "c 2"}, false)
+	checkContent(t, "no commit", map[string]string{cpp: "cpp 1", c: "c 1"})
+
+	writeOutputSet(t, cpp, map[string]string{cpp: "cpp 3", c: "c 3"}, true)
+	checkContent(t, "second commit", map[string]string{cpp: "cpp 3", c: "c 3"})
+
+	// only the current set is kept
+	sets, err := filepath.Glob(filepath.Join(dir, ".c++.local.properties.d", "set-*"))
+	if err != nil || len(sets) != 1 {
+		t.Errorf("got sets %q, %v", sets, err)
+	}
+}
+
+func TestOutputSetReplacesRegularFiles(t *testing.T) {
+	dir := t.TempDir()
+	cpp := filepath.Join(dir, "c++.local.properties")
+	c := filepath.Join(dir, "c.local.properties")
+	if err := ioutil.WriteFile(cpp, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeOutputSet(t, cpp, map[string]string{cpp: "cpp 1", c: "c 1"}, true)
+	checkContent(t, "commit", map[string]string{cpp: "cpp 1", c: "c 1"})
+}
+
+func TestOutputSetDirectory(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewOutputSet(filepath.Join(dir, "c++.local.properties"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Cleanup()
+	if _, err := s.Create(filepath.Join(dir, "sub", "c.local.properties")); err == nil {
+		t.Error("no error for a file in another directory")
+	}
+	if _, err := s.Create(filepath.Join(dir, "c.local.properties")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Create(filepath.Join(dir, "c.local.properties")); err == nil {
+		t.Error("no error for a file created twice")
+	}
+}
@@ -0,0 +1,322 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+// This file contains the creation of libraries from pkg-config .pc files,
+// for externals which come without a compilation database. The .pc files are
+// read directly, pkg-config itself is not needed.
+
+package cc2ce
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PkgConfigPackage is the content of a .pc file, with all variables
+// expanded. Requires and RequiresPrivate are the package names only,
+// version constraints are dropped.
+type PkgConfigPackage struct {
+	Module          string // the name of the .pc file, by which others require it
+	Name            string
+	Description     string
+	URL             string
+	Version         string
+	Requires        []string
+	RequiresPrivate []string
+	Cflags          []string
+	Libs            []string
+}
+
+// pkgConfigLines reads the logical lines of a .pc file: comments are
+// removed and lines ending in a backslash are continued.
+func pkgConfigLines(content []byte) ([]string, error) {
+	var lines []string
+	var current strings.Builder
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if i := strings.Index(line, "#"); i >= 0 && (i == 0 || line[i-1] != '\\') {
+			line = line[:i]
+		}
+		line = strings.Replace(line, "\\#", "#", -1)
+		if strings.HasSuffix(line, "\\") {
+			current.WriteString(line[:len(line)-1])
+			continue
+		}
+		current.WriteString(line)
+		lines = append(lines, current.String())
+		current.Reset()
+	}
+	if current.Len() != 0 {
+		lines = append(lines, current.String())
+	}
+	return lines, scanner.Err()
+}
+
+// expandPkgConfigVariables replaces ${name} by the value of the variable.
+func expandPkgConfigVariables(value string, variables map[string]string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch {
+		case strings.HasPrefix(value[i:], "$$"):
+			b.WriteByte('$')
+			i++
+		case strings.HasPrefix(value[i:], "${"):
+			end := strings.Index(value[i:], "}")
+			if end < 0 {
+				return "", fmt.Errorf("unterminated variable reference in %q", value)
+			}
+			name := value[i+2 : i+end]
+			v, found := variables[name]
+			if !found {
+				return "", fmt.Errorf("undefined variable %s", name)
+			}
+			b.WriteString(v)
+			i += end
+		default:
+			b.WriteByte(value[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// parsePkgConfigRequires turns e.g. "glib-2.0 >= 2.50, zlib" into the
+// package names.
+func parsePkgConfigRequires(value string) []string {
+	var names []string
+	words := strings.Fields(strings.Replace(value, ",", " ", -1))
+	for i := 0; i < len(words); i++ {
+		switch words[i] {
+		case "=", "!=", "<", ">", "<=", ">=":
+			// skip the operator and the version
+			i++
+			continue
+		}
+		names = append(names, words[i])
+	}
+	return names
+}
+
+// ParsePkgConfig parses the content of a .pc file. The directory of the
+// file is needed for the predefined pcfiledir variable.
+func ParsePkgConfig(module string, content []byte, pcfiledir string) (PkgConfigPackage, error) {
+	pkg := PkgConfigPackage{Module: module}
+	lines, err := pkgConfigLines(content)
+	if err != nil {
+		return pkg, err
+	}
+	variables := map[string]string{"pcfiledir": pcfiledir}
+	for n, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		// a variable definition has its = before any :, a field its : before any =
+		eq := strings.Index(line, "=")
+		colon := strings.Index(line, ":")
+		if eq >= 0 && (colon < 0 || eq < colon) {
+			name := strings.TrimSpace(line[:eq])
+			value, err := expandPkgConfigVariables(strings.TrimSpace(line[eq+1:]), variables)
+			if err != nil {
+				return pkg, fmt.Errorf("line %d: %v", n+1, err)
+			}
+			variables[name] = value
+			continue
+		}
+		if colon < 0 {
+			return pkg, fmt.Errorf("line %d: neither a variable nor a field: %s", n+1, line)
+		}
+		value, err := expandPkgConfigVariables(strings.TrimSpace(line[colon+1:]), variables)
+		if err != nil {
+			return pkg, fmt.Errorf("line %d: %v", n+1, err)
+		}
+		switch strings.ToLower(strings.TrimSpace(line[:colon])) {
+		case "name":
+			pkg.Name = value
+		case "description":
+			pkg.Description = value
+		case "url":
+			pkg.URL = value
+		case "version":
+			pkg.Version = value
+		case "requires":
+			pkg.Requires = parsePkgConfigRequires(value)
+		case "requires.private":
+			pkg.RequiresPrivate = parsePkgConfigRequires(value)
+		case "cflags":
+			if pkg.Cflags, err = SplitCommand(value); err != nil {
+				return pkg, fmt.Errorf("line %d: %v", n+1, err)
+			}
+		case "libs":
+			if pkg.Libs, err = SplitCommand(value); err != nil {
+				return pkg, fmt.Errorf("line %d: %v", n+1, err)
+			}
+		}
+	}
+	return pkg, nil
+}
+
+// PkgConfigByName finds the .pc file of a package in the directories of
+// searchPath (colon separated, as PKG_CONFIG_PATH), and parses it.
+func PkgConfigByName(module string, searchPath string) (PkgConfigPackage, error) {
+	for _, dir := range filepath.SplitList(searchPath) {
+		if dir == "" {
+			continue
+		}
+		candidate := filepath.Join(dir, module+".pc")
+		content, err := ioutil.ReadFile(candidate)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return PkgConfigPackage{Module: module}, err
+		}
+		pcfiledir, err := filepath.Abs(dir)
+		if err != nil {
+			return PkgConfigPackage{Module: module}, err
+		}
+		pkg, err := ParsePkgConfig(module, content, pcfiledir)
+		if err != nil {
+			return pkg, fmt.Errorf("%s: %w", candidate, err)
+		}
+		return pkg, nil
+	}
+	return PkgConfigPackage{Module: module}, fmt.Errorf("package %s not found in %q", module, searchPath)
+}
+
+// pkgConfigResolver loads packages and their requirements, each only once.
+type pkgConfigResolver struct {
+	searchPath string
+	packages   map[string]PkgConfigPackage
+}
+
+// closure returns the package and everything it requires (transitively),
+// the package first and then its requirements in the order in which they
+// are listed. Requires.private is followed only when private is true.
+func (r *pkgConfigResolver) closure(module string, private bool) ([]PkgConfigPackage, error) {
+	var result []PkgConfigPackage
+	seen := make(map[string]bool)
+	var visit func(module string, chain []string) error
+	visit = func(module string, chain []string) error {
+		if seen[module] {
+			return nil
+		}
+		seen[module] = true
+		pkg, found := r.packages[module]
+		if !found {
+			var err error
+			pkg, err = PkgConfigByName(module, r.searchPath)
+			if err != nil {
+				if len(chain) != 0 {
+					return fmt.Errorf("%w (required by %s)", err, strings.Join(chain, " <- "))
+				}
+				return err
+			}
+			r.packages[module] = pkg
+		}
+		result = append(result, pkg)
+		requires := pkg.Requires
+		if private {
+			requires = append(append([]string{}, requires...), pkg.RequiresPrivate...)
+		}
+		for _, req := range requires {
+			if err := visit(req, append([]string{module}, chain...)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return result, visit(module, nil)
+}
+
+// PkgConfigLibraries creates one library per package. Include paths and
+// defines are taken from the Cflags of the package and of everything it
+// requires (including Requires.private, as pkg-config --cflags does), link
+// directories and libraries from the Libs of the package and its (public)
+// requirements. The version of the library is the Version of the package.
+//
+// searchPath is a colon separated list of directories, as PKG_CONFIG_PATH.
+// Unlike pkg-config, no system directories are searched in addition.
+func PkgConfigLibraries(modules []string, searchPath string) ([]Library, error) {
+	resolver := pkgConfigResolver{searchPath: searchPath, packages: make(map[string]PkgConfigPackage)}
+	var libs []Library
+	for _, module := range modules {
+		cflagsPackages, err := resolver.closure(module, true)
+		if err != nil {
+			return libs, err
+		}
+		libsPackages, err := resolver.closure(module, false)
+		if err != nil {
+			return libs, err
+		}
+
+		pkg := cflagsPackages[0]
+		lib := Library{LibraryName: module, LibraryVersion: pkg.Version, LibraryUrl: pkg.URL}
+		if lib.LibraryVersion == "" {
+			lib.LibraryVersion = "default"
+		}
+
+		var defines []string
+		seenDefines := make(map[string]bool)
+		for _, p := range cflagsPackages {
+			dirs, err := IncludeDirsFromArgs(p.Cflags)
+			if err != nil {
+				return libs, fmt.Errorf("%s: %w", p.Module, err)
+			}
+			lib.Paths.AddTranslationUnit(dirs)
+			for i := 0; i < len(p.Cflags); i++ {
+				define := ""
+				if p.Cflags[i] == "-D" && i+1 < len(p.Cflags) {
+					define = p.Cflags[i+1]
+					i++
+				} else if strings.HasPrefix(p.Cflags[i], "-D") {
+					define = p.Cflags[i][len("-D"):]
+				}
+				if define != "" && !seenDefines[define] {
+					seenDefines[define] = true
+					defines = append(defines, OptionArgument("-D"+define))
+				}
+			}
+		}
+		lib.Options = strings.Join(defines, " ")
+
+		seenLinks := make(map[string]bool)
+		for _, p := range libsPackages {
+			for i := 0; i < len(p.Libs); i++ {
+				w := p.Libs[i]
+				if !strings.HasPrefix(w, "-L") && !strings.HasPrefix(w, "-l") {
+					continue
+				}
+				flag, value := w[:2], w[2:]
+				if value == "" && i+1 < len(p.Libs) {
+					value = p.Libs[i+1]
+					i++
+				}
+				if value == "" || seenLinks[flag+value] {
+					continue
+				}
+				seenLinks[flag+value] = true
+				if flag == "-L" {
+					lib.LibPaths = append(lib.LibPaths, value)
+				} else {
+					lib.LibLink = append(lib.LibLink, value)
+				}
+			}
+		}
+		libs = append(libs, lib)
+	}
+	return libs, nil
+}
@@ -0,0 +1,254 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+package cc2ce
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpandPkgConfigVariables(t *testing.T) {
+	variables := map[string]string{"prefix": "/usr", "libdir": "/usr/lib", "empty": ""}
+	tests := []struct {
+		value string
+		want  string
+		err   string
+	}{
+		{value: "${prefix}/include", want: "/usr/include"},
+		{value: "-L${libdir} -lfoo", want: "-L/usr/lib -lfoo"},
+		{value: "${prefix}${empty}/share", want: "/usr/share"},
+		{value: "$$HOME", want: "$HOME"},
+		{value: "$${prefix}", want: "${prefix}"},
+		{value: "cost: 5$", want: "cost: 5$"},
+		{value: "${undefined}/include", err: "undefined variable undefined"},
+		{value: "${prefix", err: "unterminated variable reference"},
+	}
+	for _, tt := range tests {
+		got, err := expandPkgConfigVariables(tt.value, variables)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%q: got error %v, want %q", tt.value, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%q: got %q, %v, want %q", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestPkgConfigLines(t *testing.T) {
+	tests := []struct {
+		content string
+		want    []string
+	}{
+		{"a=1\nb=2\n", []string{"a=1", "b=2"}},
+		{"Cflags: -I/a \\\n-I/b\n", []string{"Cflags: -I/a -I/b"}},
+		{"Libs: -la \\\n  -lb \\\n  -lc\nName: x\n", []string{"Libs: -la   -lb   -lc", "Name: x"}},
+		{"# comment\nName: x # trailing\n", []string{"", "Name: x "}},
+		{"Description: number \\#1\n", []string{"Description: number #1"}},
+		{"Name: x\r\n", []string{"Name: x"}},
+		// a continuation on the last line ends with the file
+		{"Libs: -la \\", []string{"Libs: -la "}},
+	}
+	for _, tt := range tests {
+		got, err := pkgConfigLines([]byte(tt.content))
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %q, %v, want %q", tt.content, got, err, tt.want)
+		}
+	}
+}
+
+func TestParsePkgConfigRequires(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"", nil},
+		{"zlib", []string{"zlib"}},
+		{"glib-2.0 >= 2.50, zlib", []string{"glib-2.0", "zlib"}},
+		{"a = 1.0 b != 2 c < 3, d > 4,e <= 5 f >= 6", []string{"a", "b", "c", "d", "e", "f"}},
+		{"gio-2.0,gobject-2.0", []string{"gio-2.0", "gobject-2.0"}},
+	}
+	for _, tt := range tests {
+		if got := parsePkgConfigRequires(tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParsePkgConfig(t *testing.T) {
+	content := `# foo.pc
+prefix=/opt/foo
+includedir=${prefix}/include
+libdir=${prefix}/lib
+data=${pcfiledir}/../share
+
+Name: Foo
+Description: The foo library, $$5
+URL: https://example.org/foo
+Version: 1.2.3
+Requires: bar >= 1.0, baz
+Requires.private: qux
+Cflags: -I${includedir} -I${includedir}/foo \
+        -DFOO_DATA="${data}"
+Libs: -L${libdir} -lfoo
+`
+	pkg, err := ParsePkgConfig("foo", []byte(content), "/opt/foo/lib/pkgconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := PkgConfigPackage{
+		Module:          "foo",
+		Name:            "Foo",
+		Description:     "The foo library, $5",
+		URL:             "https://example.org/foo",
+		Version:         "1.2.3",
+		Requires:        []string{"bar", "baz"},
+		RequiresPrivate: []string{"qux"},
+		Cflags:          []string{"-I/opt/foo/include", "-I/opt/foo/include/foo", "-DFOO_DATA=/opt/foo/lib/pkgconfig/../share"},
+		Libs:            []string{"-L/opt/foo/lib", "-lfoo"},
+	}
+	if !reflect.DeepEqual(pkg, want) {
+		t.Errorf("got %+v, want %+v", pkg, want)
+	}
+
+	invalid := []struct {
+		content string
+		err     string
+	}{
+		{"prefix=/usr\nCflags: -I${includedir}\n", "line 2: undefined variable includedir"},
+		{"libdir=${prefix}/lib\n", "line 1: undefined variable prefix"},
+		{"Name: x\njust words\n", "line 2: neither a variable nor a field"},
+		{"Cflags: -I\"/unterminated\n", "line 1:"},
+	}
+	for _, tt := range invalid {
+		if _, err := ParsePkgConfig("x", []byte(tt.content), "/"); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: got error %v, want %q", tt.content, err, tt.err)
+		}
+	}
+}
+
+// writePkgConfigFiles writes .pc files, keyed on the module, to a directory.
+func writePkgConfigFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for module, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, module+".pc"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestPkgConfigLibraries(t *testing.T) {
+	dir := writePkgConfigFiles(t, map[string]string{
+		"app": `Version: 2.0
+URL: https://example.org/app
+Requires: gui
+Requires.private: zlib
+Cflags: -I/app/include -DAPP
+Libs: -L/app/lib -lapp
+`,
+		// gui and widgets require each other
+		"gui": `Version: 1.0
+Requires: widgets >= 1.0
+Cflags: -I/gui/include -D GUI=1
+Libs: -L/gui/lib -lgui
+`,
+		"widgets": `Requires: gui
+Cflags: -I/widgets/include -DAPP
+Libs: -L /gui/lib -lwidgets
+`,
+		"zlib": `Cflags: -I/zlib/include -DZLIB
+Libs: -lz
+`,
+	})
+
+	libs, err := PkgConfigLibraries([]string{"app", "widgets"}, "/nonexistent:"+dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(libs) != 2 {
+		t.Fatalf("got %d libraries, want 2", len(libs))
+	}
+	tests := []struct {
+		lib      Library
+		name     string
+		version  string
+		url      string
+		includes []string
+		options  string
+		libPaths []string
+		libLink  []string
+	}{
+		{
+			lib:      libs[0],
+			name:     "app",
+			version:  "2.0",
+			url:      "https://example.org/app",
+			includes: []string{"/app/include", "/gui/include", "/widgets/include", "/zlib/include"},
+			// Cflags of Requires.private, but not its Libs
+			options:  "-DAPP -DGUI=1 -DZLIB",
+			libPaths: []string{"/app/lib", "/gui/lib"},
+			libLink:  []string{"app", "gui", "widgets"},
+		},
+		{
+			lib:      libs[1],
+			name:     "widgets",
+			version:  "default",
+			includes: []string{"/widgets/include", "/gui/include"},
+			options:  "-DAPP -DGUI=1",
+			libPaths: []string{"/gui/lib"},
+			libLink:  []string{"widgets", "gui"},
+		},
+	}
+	for _, tt := range tests {
+		lib := tt.lib
+		if lib.LibraryName != tt.name || lib.LibraryVersion != tt.version || lib.LibraryUrl != tt.url {
+			t.Errorf("%s: got name %q, version %q, url %q", tt.name, lib.LibraryName, lib.LibraryVersion, lib.LibraryUrl)
+		}
+		if got := lib.Paths.Paths(); !reflect.DeepEqual(got, tt.includes) {
+			t.Errorf("%s: got includes %q, want %q", tt.name, got, tt.includes)
+		}
+		if lib.Options != tt.options {
+			t.Errorf("%s: got options %q, want %q", tt.name, lib.Options, tt.options)
+		}
+		if !reflect.DeepEqual(lib.LibPaths, tt.libPaths) || !reflect.DeepEqual(lib.LibLink, tt.libLink) {
+			t.Errorf("%s: got library paths %q and libraries %q, want %q and %q", tt.name, lib.LibPaths, lib.LibLink, tt.libPaths, tt.libLink)
+		}
+	}
+}
+
+func TestPkgConfigLibrariesErrors(t *testing.T) {
+	dir := writePkgConfigFiles(t, map[string]string{
+		"a":      "Requires: b\n",
+		"b":      "Requires.private: c\n",
+		"broken": "Cflags: -I${prefix}/include\n",
+	})
+	tests := []struct {
+		module string
+		err    string
+	}{
+		{"missing", "package missing not found"},
+		{"a", "package c not found in " + `"` + dir + `" (required by b <- a)`},
+		{"broken", "broken.pc: line 1: undefined variable prefix"},
+	}
+	for _, tt := range tests {
+		if _, err := PkgConfigLibraries([]string{tt.module}, dir); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.module, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+// This file contains the policy which flags of a compiler call become
+// compiler options in Compiler Explorer.
+
+package cc2ce
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// defaultFlagCategories are the categories of flags which become options by
+// default: those that change what code gets compiled or generated. Flags
+// about the build (output, dependency files, linking), the diagnostics
+// format, debug info and instrumentation are left out, as are include
+// paths, which go into libraries.
+var defaultFlagCategories = []FlagCategory{
+	FlagDefine,
+	FlagUndefine,
+	FlagStandard,
+	FlagTarget,
+	FlagOptimization,
+	FlagWarning,
+	FlagCodegen,
+}
+
+// FlagPolicy decides which flags of a compiler call become compiler options
+// (see OptionsFromCommands). A flag is allowed by its category, unless a
+// pattern matches the flag. Patterns are globs (with * and ?) matched
+// against the flag as written, with its words joined by a space, e.g.
+// "-fsanitize=*" or "--param max-inline-insns=5". Deny patterns take
+// precedence over allow patterns.
+//
+// The zero value allows no flags, NewFlagPolicy returns the default policy.
+type FlagPolicy struct {
+	categories map[FlagCategory]bool
+	allow      []*regexp.Regexp
+	deny       []*regexp.Regexp
+}
+
+// NewFlagPolicy returns the default policy, to be modified with Allow and
+// Deny.
+func NewFlagPolicy() FlagPolicy {
+	p := FlagPolicy{categories: make(map[FlagCategory]bool)}
+	for _, c := range defaultFlagCategories {
+		p.categories[c] = true
+	}
+	return p
+}
+
+// DefaultFlagPolicy is the policy used when selecting compiler options.
+var DefaultFlagPolicy = NewFlagPolicy()
+
+// set allows or denies an item, see Allow.
+func (p *FlagPolicy) set(item string, allowed bool) error {
+	if c, found := FlagCategoryByName(item); found {
+		if p.categories == nil {
+			p.categories = make(map[FlagCategory]bool)
+		}
+		p.categories[c] = allowed
+		return nil
+	}
+	if !strings.HasPrefix(item, "-") {
+		return fmt.Errorf("%q is neither a flag category nor a flag pattern", item)
+	}
+	re, err := globRegexp(item)
+	if err != nil {
+		return err
+	}
+	if allowed {
+		p.allow = append(p.allow, re)
+	} else {
+		p.deny = append(p.deny, re)
+	}
+	return nil
+}
+
+// Allow allows a category of flags (given by name, see FlagCategoryByName,
+// e.g. "debug") or the flags matching a pattern (e.g. "-fsanitize=address").
+func (p *FlagPolicy) Allow(item string) error {
+	return p.set(item, true)
+}
+
+// Deny denies a category of flags or the flags matching a pattern, see
+// Allow.
+func (p *FlagPolicy) Deny(item string) error {
+	return p.set(item, false)
+}
+
+// Allows tells if a flag becomes a compiler option.
+func (p FlagPolicy) Allows(flag Flag) bool {
+	written := strings.Join(flag.Args, " ")
+	for _, re := range p.deny {
+		if re.MatchString(written) {
+			return false
+		}
+	}
+	for _, re := range p.allow {
+		if re.MatchString(written) {
+			return true
+		}
+	}
+	return p.categories[flag.Category]
+}
+
+// flagPolicyFile is the content of a policy file, see FlagPolicyByBytes.
+type flagPolicyFile struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// FlagPolicyByBytes reads a policy from json of the form
+//
+//	{
+//	  "allow": ["debug", "-fsanitize=address"],
+//	  "deny": ["undefine", "-march=*"]
+//	}
+//
+// where each entry is a category or a pattern as for FlagPolicy.Allow. The
+// entries modify the default policy, see NewFlagPolicy.
+func FlagPolicyByBytes(content []byte) (FlagPolicy, error) {
+	p := NewFlagPolicy()
+	var file flagPolicyFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return p, err
+	}
+	for _, item := range file.Allow {
+		if err := p.Allow(item); err != nil {
+			return p, err
+		}
+	}
+	for _, item := range file.Deny {
+		if err := p.Deny(item); err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+// FlagPolicyByFilename reads a policy file, see FlagPolicyByBytes.
+func FlagPolicyByFilename(name string) (FlagPolicy, error) {
+	content, err := ioutil.ReadFile(name)
+	if err != nil {
+		return NewFlagPolicy(), err
+	}
+	p, err := FlagPolicyByBytes(content)
+	if err != nil {
+		return p, fmt.Errorf("%s: %w", name, err)
+	}
+	return p, nil
+}
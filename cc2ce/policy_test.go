@@ -0,0 +1,68 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+package cc2ce
+
+import (
+	"testing"
+)
+
+func TestFlagPolicyZeroValue(t *testing.T) {
+	var p FlagPolicy
+	optimization := Flag{Category: FlagOptimization, Args: []string{"-O2"}}
+	if p.Allows(optimization) {
+		t.Error("the zero policy allows -O2")
+	}
+	if err := p.Allow("optimization"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Allow("-fsanitize=*"); err != nil {
+		t.Fatal(err)
+	}
+	if !p.Allows(optimization) {
+		t.Error("-O2 not allowed after allowing optimization")
+	}
+	if !p.Allows(Flag{Category: FlagInstrumentation, Args: []string{"-fsanitize=address"}}) {
+		t.Error("-fsanitize=address not allowed by pattern")
+	}
+	if p.Allows(Flag{Category: FlagWarning, Args: []string{"-Wall"}}) {
+		t.Error("-Wall allowed without allowing warnings")
+	}
+}
+
+func TestFlagPolicyByBytes(t *testing.T) {
+	p, err := FlagPolicyByBytes([]byte(`{"allow": ["debug", "-fsanitize=address"], "deny": ["-march=*"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		flag    Flag
+		allowed bool
+	}{
+		{Flag{Category: FlagOptimization, Args: []string{"-O2"}}, true},
+		{Flag{Category: FlagDebug, Args: []string{"-g"}}, true},
+		{Flag{Category: FlagInstrumentation, Args: []string{"-fsanitize=address"}}, true},
+		{Flag{Category: FlagInstrumentation, Args: []string{"-fsanitize=thread"}}, false},
+		{Flag{Category: FlagTarget, Args: []string{"-march=native"}}, false},
+		{Flag{Category: FlagTarget, Args: []string{"-m64"}}, true},
+		{Flag{Category: FlagOutput, Args: []string{"-o", "a.o"}}, false},
+	}
+	for _, tt := range tests {
+		if got := p.Allows(tt.flag); got != tt.allowed {
+			t.Errorf("%q: got %v, want %v", tt.flag.Args, got, tt.allowed)
+		}
+	}
+
+	if _, err := FlagPolicyByBytes([]byte(`{"allow": ["sanitizers"]}`)); err == nil {
+		t.Error("no error for an unknown category")
+	}
+}
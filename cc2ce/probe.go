@@ -0,0 +1,353 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+// This file contains the probing of a compiler (by running it) for its
+// family, version, target and builtin include paths, and a cache of the
+// results such that compilers don't get run on every invocation.
+
+package cc2ce
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	write "github.com/google/renameio"
+)
+
+// CompilerInfo is what probing a compiler found out.
+//   - Exe is the compiler call that was probed
+//   - Family is one of "gcc", "clang", "icc", "nvcc", or empty if unknown
+//   - Version is the semantic version, e.g. "12.2.0"
+//   - Target is the target triple, e.g. "x86_64-pc-linux-gnu"
+//   - SystemIncludes are the directories the compiler searches without
+//     being told, in search order
+type CompilerInfo struct {
+	Exe            string
+	Family         string
+	Version        string
+	Target         string
+	SystemIncludes []string
+}
+
+// compilerTypes maps families to the compilerType setting of Compiler
+// Explorer. Families not listed use the default (gcc compatible) type.
+var compilerTypes = map[string]string{
+	"clang": "clang",
+	"nvcc":  "nvcc",
+}
+
+// CompilerType returns the compilerType setting for the compiler in
+// Compiler Explorer, empty for the default.
+func (ci CompilerInfo) CompilerType() string {
+	return compilerTypes[ci.Family]
+}
+
+// Name returns a display name for the compiler, e.g. "gcc 12.2.0".
+func (ci CompilerInfo) Name() string {
+	family := ci.Family
+	if family == "" {
+		family = filepath.Base(ci.Exe)
+	}
+	if ci.Version == "" {
+		return family
+	}
+	return family + " " + ci.Version
+}
+
+// ID returns an ID for the compiler in the Compiler Explorer configuration,
+// which stays the same as long as the compiler family and version do, e.g.
+// "gcc_12_2_0".
+func (ci CompilerInfo) ID() string {
+	return strings.Trim(propertyKey(strings.Replace(ci.Name(), " ", "_", -1)), "_")
+}
+
+// GuessCompilerFamily guesses the family of a compiler from its name, for
+// when it can't be probed. Version suffixes and target prefixes are
+// allowed, e.g. x86_64-linux-gnu-g++-12 is gcc. Unknown compilers return
+// an empty family.
+func GuessCompilerFamily(exe string) string {
+	name := exe
+	if call, err := SplitCommand(exe); err == nil && len(call) != 0 {
+		name = call[len(call)-1]
+	}
+	name = filepath.Base(name)
+	switch {
+	case strings.Contains(name, "clang"):
+		return "clang"
+	case strings.Contains(name, "nvcc"):
+		return "nvcc"
+	case strings.HasPrefix(name, "icc"), strings.HasPrefix(name, "icpc"), strings.HasPrefix(name, "icx"), strings.HasPrefix(name, "icpx"), strings.HasPrefix(name, "ifort"):
+		return "icc"
+	}
+	for _, gcc := range []string{"gcc", "g++", "gfortran", "cc", "c++"} {
+		if name == gcc || strings.HasPrefix(name, gcc+"-") || strings.HasSuffix(name, "-"+gcc) || strings.Contains(name, "-"+gcc+"-") {
+			return "gcc"
+		}
+	}
+	return ""
+}
+
+// runCompiler runs a compiler call with additional arguments and returns
+// its combined output. It is a variable to be replaceable in tests.
+var runCompiler = func(call []string, args ...string) (string, error) {
+	cmd := exec.Command(call[0], append(append([]string{}, call[1:]...), args...)...)
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+var (
+	gccVersionRe   = regexp.MustCompile(`\(GCC\)|Free Software Foundation`)
+	clangVersionRe = regexp.MustCompile(`clang version ([0-9]+(\.[0-9]+)*)`)
+	iccVersionRe   = regexp.MustCompile(`\(ICC\) ([0-9]+(\.[0-9]+)*)`)
+	nvccVersionRe  = regexp.MustCompile(`Cuda compilation tools, release [0-9.]+, V([0-9]+(\.[0-9]+)*)`)
+	anyVersionRe   = regexp.MustCompile(`[0-9]+\.[0-9]+(\.[0-9]+)?`)
+)
+
+// parseVersionOutput determines family and version from the output of
+// --version. For gcc, the version in the output is distribution specific,
+// the caller should rather use -dumpfullversion.
+func parseVersionOutput(out string) (string, string) {
+	firstLine := strings.SplitN(out, "\n", 2)[0]
+	if m := nvccVersionRe.FindStringSubmatch(out); m != nil {
+		return "nvcc", m[1]
+	}
+	if m := iccVersionRe.FindStringSubmatch(firstLine); m != nil {
+		return "icc", m[1]
+	}
+	if m := clangVersionRe.FindStringSubmatch(firstLine); m != nil {
+		return "clang", m[1]
+	}
+	if gccVersionRe.MatchString(out) {
+		versions := anyVersionRe.FindAllString(firstLine, -1)
+		if len(versions) == 0 {
+			return "gcc", ""
+		}
+		return "gcc", versions[len(versions)-1]
+	}
+	return "", ""
+}
+
+// parseVerboseOutput extracts the target and the builtin include
+// directories from the output of -E -v.
+func parseVerboseOutput(out string) (string, []string) {
+	target := ""
+	var includes []string
+	inSearchList := false
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "Target: "):
+			target = strings.TrimSpace(line[len("Target: "):])
+		case strings.HasPrefix(line, "#include <...> search starts here:"):
+			inSearchList = true
+		case strings.HasPrefix(line, "End of search list."):
+			inSearchList = false
+		case inSearchList && strings.HasPrefix(line, " "):
+			dir := strings.TrimSpace(line)
+			// macOS marks framework directories
+			dir = strings.TrimSuffix(dir, " (framework directory)")
+			includes = append(includes, filepath.Clean(dir))
+		}
+	}
+	return target, includes
+}
+
+// ProbeCompiler runs a compiler call (e.g. "/usr/bin/g++", possibly with
+// wrappers, see CompilerFromCommands) with --version, -dumpfullversion and
+// -E -v to find out what compiler it is. See CompilerCache for a cached
+// version.
+//
+// The builtin include directories differ between languages (C doesn't get
+// those of the C++ standard library), they are those of the given language
+// (e.g. LanguageC). Languages that can't be preprocessed by name (CUDA) get
+// those of C++.
+func ProbeCompiler(exe string, language string) (CompilerInfo, error) {
+	info := CompilerInfo{Exe: exe}
+	call, err := SplitCommand(exe)
+	if err != nil {
+		return info, err
+	}
+	if len(call) == 0 {
+		return info, fmt.Errorf("no compiler given")
+	}
+
+	out, err := runCompiler(call, "--version")
+	if err != nil {
+		return info, fmt.Errorf("running %s --version: %v", exe, err)
+	}
+	info.Family, info.Version = parseVersionOutput(out)
+
+	if info.Family == "gcc" {
+		// unlike --version, this has no distribution specific decoration
+		if out, err := runCompiler(call, "-dumpfullversion", "-dumpversion"); err == nil {
+			if v := strings.TrimSpace(out); anyVersionRe.MatchString(v) {
+				info.Version = v
+			}
+		}
+	}
+
+	if info.Family != "nvcc" {
+		// the search list is printed to stderr even if preprocessing fails
+		x, found := flagProbeLanguages[language]
+		if !found {
+			x = flagProbeLanguages[LanguageCpp]
+		}
+		out, _ := runCompiler(call, "-E", "-v", "-x", x, os.DevNull)
+		info.Target, info.SystemIncludes = parseVerboseOutput(out)
+	}
+	if info.Target == "" {
+		if out, err := runCompiler(call, "-dumpmachine"); err == nil {
+			info.Target = strings.TrimSpace(out)
+		}
+	}
+	return info, nil
+}
+
+type cachedCompiler struct {
+	ModTime int64                   `json:"mtime"`
+	Infos   map[string]CompilerInfo `json:"infos,omitempty"` // per language
+	Flags   map[string]bool         `json:"flags,omitempty"` // see FlagSupported
+}
+
+// CompilerCache keeps the results of ProbeCompiler (per language) and
+// FlagSupported, keyed on the compiler call. An entry is only used as long
+// as the modification time of the compiler executable is the same as when
+// it was probed.
+//
+// A nil *CompilerCache is valid and probes every time.
+type CompilerCache struct {
+	path    string
+	entries map[string]cachedCompiler
+	changed bool
+}
+
+// DefaultCompilerCachePath is the cache file in the user's cache
+// directory.
+func DefaultCompilerCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "compilecommands_to_compilerexplorer", "compilers.json"), nil
+}
+
+// OpenCompilerCache reads the cache file at path. A missing file is an
+// empty cache.
+func OpenCompilerCache(path string) (*CompilerCache, error) {
+	c := &CompilerCache{path: path, entries: make(map[string]cachedCompiler)}
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(content, &c.entries); err != nil {
+		return c, fmt.Errorf("%s: %v", path, err)
+	}
+	return c, nil
+}
+
+// compilerModTime returns the modification time of the executable of a
+// compiler call (its last word, resolved through the PATH).
+func compilerModTime(exe string) (int64, error) {
+	call, err := SplitCommand(exe)
+	if err != nil {
+		return 0, err
+	}
+	if len(call) == 0 {
+		return 0, fmt.Errorf("no compiler given")
+	}
+	path, err := exec.LookPath(call[len(call)-1])
+	if err != nil {
+		return 0, err
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return stat.ModTime().UnixNano(), nil
+}
+
+// entry returns the cache entry of a compiler call, an empty one if it
+// isn't cached or the compiler changed since.
+func (c *CompilerCache) entry(exe string) (cachedCompiler, error) {
+	mtime, err := compilerModTime(exe)
+	if err != nil {
+		return cachedCompiler{}, err
+	}
+	entry, found := c.entries[exe]
+	if !found || entry.ModTime != mtime {
+		entry = cachedCompiler{ModTime: mtime}
+	}
+	return entry, nil
+}
+
+// Probe returns the cached CompilerInfo of a compiler call for a language,
+// or probes the compiler if it isn't cached (or changed since).
+func (c *CompilerCache) Probe(exe string, language string) (CompilerInfo, error) {
+	if c == nil {
+		return ProbeCompiler(exe, language)
+	}
+	entry, err := c.entry(exe)
+	if err != nil {
+		return CompilerInfo{Exe: exe}, err
+	}
+	if info, found := entry.Infos[language]; found {
+		return info, nil
+	}
+	info, err := ProbeCompiler(exe, language)
+	if err != nil {
+		return info, err
+	}
+	if entry.Infos == nil {
+		entry.Infos = make(map[string]CompilerInfo)
+	}
+	entry.Infos[language] = info
+	c.entries[exe] = entry
+	c.changed = true
+	return info, nil
+}
+
+// Save writes the cache file, if anything was probed since it was read.
+func (c *CompilerCache) Save() error {
+	if c == nil || !c.changed {
+		return nil
+	}
+	content, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	f, err := write.TempFile("", c.path)
+	if err != nil {
+		return err
+	}
+	defer f.Cleanup()
+	if _, err := f.Write(content); err != nil {
+		return err
+	}
+	if err := f.CloseAtomicallyReplace(); err != nil {
+		return err
+	}
+	c.changed = false
+	return nil
+}
@@ -0,0 +1,240 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+package cc2ce
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// cannedCompiler is the output of a compiler for the calls of
+// ProbeCompiler, keyed on the first argument. The output of -E is keyed on
+// the language instead, as "-x c", "-x c++" etc.
+type cannedCompiler map[string]string
+
+var cannedCompilers = map[string]cannedCompiler{
+	"g++": {
+		"--version": "g++ (Ubuntu 12.3.0-1ubuntu1~22.04) 12.3.0\n" +
+			"Copyright (C) 2022 Free Software Foundation, Inc.\n",
+		"-dumpfullversion": "12.3.0\n",
+		"-x c++": "Using built-in specs.\n" +
+			"Target: x86_64-linux-gnu\n" +
+			"#include \"...\" search starts here:\n" +
+			"#include <...> search starts here:\n" +
+			" /usr/include/c++/12\n" +
+			" /usr/include/x86_64-linux-gnu/c++/12\n" +
+			" /usr/lib/gcc/x86_64-linux-gnu/12/include\n" +
+			" /usr/include\n" +
+			"End of search list.\n",
+		"-x c": "Using built-in specs.\n" +
+			"Target: x86_64-linux-gnu\n" +
+			"#include <...> search starts here:\n" +
+			" /usr/lib/gcc/x86_64-linux-gnu/12/include\n" +
+			" /usr/include\n" +
+			"End of search list.\n",
+	},
+	"clang++": {
+		"--version": "Ubuntu clang version 15.0.7\n" +
+			"Target: x86_64-pc-linux-gnu\n" +
+			"Thread model: posix\n",
+		"-x c++": "Ubuntu clang version 15.0.7\n" +
+			"Target: x86_64-pc-linux-gnu\n" +
+			"#include <...> search starts here:\n" +
+			" /usr/lib/gcc/x86_64-linux-gnu/12/../../../../include/c++/12\n" +
+			" /usr/lib/llvm-15/lib/clang/15.0.7/include\n" +
+			" /usr/include\n" +
+			"End of search list.\n",
+	},
+	"icpc": {
+		"--version": "icpc (ICC) 2021.10.0 20230609\n" +
+			"Copyright (C) 1985-2023 Intel Corporation.  All rights reserved.\n",
+		"-x c++": "#include <...> search starts here:\n" +
+			" /opt/intel/oneapi/compiler/2023.2.0/linux/compiler/include\n" +
+			" /usr/include\n" +
+			"End of search list.\n",
+		"-dumpmachine": "x86_64-linux-gnu\n",
+	},
+	"nvcc": {
+		"--version": "nvcc: NVIDIA (R) Cuda compiler driver\n" +
+			"Copyright (c) 2005-2023 NVIDIA Corporation\n" +
+			"Built on Tue_Feb__7_19:32:13_PST_2023\n" +
+			"Cuda compilation tools, release 12.1, V12.1.66\n" +
+			"Build cuda_12.1.r12.1/compiler.32415258_0\n",
+		"-dumpmachine": "x86_64-linux-gnu\n",
+	},
+}
+
+// fakeRunCompiler replaces runCompiler with the canned output of the
+// compiler of the executable's name, and records the calls.
+func fakeRunCompiler(t *testing.T) *[]string {
+	var calls []string
+	original := runCompiler
+	t.Cleanup(func() { runCompiler = original })
+	runCompiler = func(call []string, args ...string) (string, error) {
+		calls = append(calls, strings.Join(append(append([]string{}, call...), args...), " "))
+		canned, found := cannedCompilers[filepath.Base(call[len(call)-1])]
+		if !found {
+			return "", errors.New("executable file not found in $PATH")
+		}
+		key := args[0]
+		for i, a := range args {
+			if a == "-x" && i+1 < len(args) {
+				key = "-x " + args[i+1]
+			}
+		}
+		out, found := canned[key]
+		if !found {
+			return "unrecognized option " + args[0], errors.New("exit status 1")
+		}
+		return out, nil
+	}
+	return &calls
+}
+
+func TestParseVersionOutput(t *testing.T) {
+	tests := []struct {
+		compiler        string
+		family, version string
+	}{
+		{"g++", "gcc", "12.3.0"},
+		{"clang++", "clang", "15.0.7"},
+		{"icpc", "icc", "2021.10.0"},
+		{"nvcc", "nvcc", "12.1.66"},
+	}
+	for _, tt := range tests {
+		family, version := parseVersionOutput(cannedCompilers[tt.compiler]["--version"])
+		if family != tt.family || version != tt.version {
+			t.Errorf("%s: got %q %q, want %q %q", tt.compiler, family, version, tt.family, tt.version)
+		}
+	}
+	if family, version := parseVersionOutput("frobnicate 1.0\n"); family != "" || version != "" {
+		t.Errorf("unknown compiler: got %q %q", family, version)
+	}
+}
+
+func TestParseVerboseOutput(t *testing.T) {
+	target, includes := parseVerboseOutput(cannedCompilers["clang++"]["-x c++"])
+	if target != "x86_64-pc-linux-gnu" {
+		t.Errorf("got target %q", target)
+	}
+	want := []string{
+		"/usr/include/c++/12",
+		"/usr/lib/llvm-15/lib/clang/15.0.7/include",
+		"/usr/include",
+	}
+	if !reflect.DeepEqual(includes, want) {
+		t.Errorf("got includes %q, want %q", includes, want)
+	}
+
+	out := "#include <...> search starts here:\n" +
+		" /usr/include\n" +
+		" /System/Library/Frameworks (framework directory)\n" +
+		"End of search list.\n"
+	if _, includes := parseVerboseOutput(out); !reflect.DeepEqual(includes, []string{"/usr/include", "/System/Library/Frameworks"}) {
+		t.Errorf("got framework includes %q", includes)
+	}
+}
+
+func TestProbeCompiler(t *testing.T) {
+	tests := []struct {
+		exe      string
+		language string
+		want     CompilerInfo
+	}{
+		{
+			exe:      "/usr/bin/g++",
+			language: LanguageCpp,
+			want: CompilerInfo{Family: "gcc", Version: "12.3.0", Target: "x86_64-linux-gnu",
+				SystemIncludes: []string{"/usr/include/c++/12", "/usr/include/x86_64-linux-gnu/c++/12",
+					"/usr/lib/gcc/x86_64-linux-gnu/12/include", "/usr/include"}},
+		},
+		{
+			exe:      "/usr/bin/g++",
+			language: LanguageC,
+			want: CompilerInfo{Family: "gcc", Version: "12.3.0", Target: "x86_64-linux-gnu",
+				SystemIncludes: []string{"/usr/lib/gcc/x86_64-linux-gnu/12/include", "/usr/include"}},
+		},
+		{
+			exe:      "ccache clang++",
+			language: LanguageCpp,
+			want: CompilerInfo{Family: "clang", Version: "15.0.7", Target: "x86_64-pc-linux-gnu",
+				SystemIncludes: []string{"/usr/include/c++/12", "/usr/lib/llvm-15/lib/clang/15.0.7/include", "/usr/include"}},
+		},
+		{
+			exe:      "icpc",
+			language: LanguageCpp,
+			want: CompilerInfo{Family: "icc", Version: "2021.10.0", Target: "x86_64-linux-gnu",
+				SystemIncludes: []string{"/opt/intel/oneapi/compiler/2023.2.0/linux/compiler/include", "/usr/include"}},
+		},
+		{
+			exe:      "/usr/local/cuda/bin/nvcc",
+			language: LanguageCuda,
+			want:     CompilerInfo{Family: "nvcc", Version: "12.1.66", Target: "x86_64-linux-gnu"},
+		},
+	}
+	for _, tt := range tests {
+		calls := fakeRunCompiler(t)
+		got, err := ProbeCompiler(tt.exe, tt.language)
+		if err != nil {
+			t.Errorf("%s (%s): %v", tt.exe, tt.language, err)
+			continue
+		}
+		tt.want.Exe = tt.exe
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s (%s): got %+v, want %+v", tt.exe, tt.language, got, tt.want)
+		}
+		for _, c := range *calls {
+			if strings.Contains(c, " -E ") && tt.want.Family == "nvcc" {
+				t.Errorf("%s: preprocessed with %s", tt.exe, c)
+			}
+		}
+	}
+
+	fakeRunCompiler(t)
+	if _, err := ProbeCompiler("/opt/missing/xlC", LanguageCpp); err == nil {
+		t.Error("no error for a compiler that can't be run")
+	}
+}
+
+func TestProbeCompilerLanguage(t *testing.T) {
+	tests := []struct {
+		language string
+		x        string
+	}{
+		{LanguageCpp, "-x c++"},
+		{LanguageC, "-x c"},
+		{LanguageFortran, "-x f95"},
+		{LanguageCuda, "-x c++"},
+	}
+	for _, tt := range tests {
+		calls := fakeRunCompiler(t)
+		if _, err := ProbeCompiler("g++", tt.language); err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for _, c := range *calls {
+			if strings.HasPrefix(c, "g++ -E -v ") {
+				found = true
+				if !strings.Contains(c, " "+tt.x+" ") {
+					t.Errorf("%s: preprocessed with %q, want %s", tt.language, c, tt.x)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("%s: not preprocessed", tt.language)
+		}
+	}
+}
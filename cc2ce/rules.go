@@ -0,0 +1,261 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+// This file contains the rules which decide what happens to the defines of
+// a compiler call when they become compiler options in Compiler Explorer,
+// and the built-in rule presets.
+
+package cc2ce
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// The actions of define rules.
+const (
+	// DefineDrop removes the define.
+	DefineDrop = "drop"
+	// DefineKeep keeps the define as it is, e.g. as exception to a later
+	// rule.
+	DefineKeep = "keep"
+	// DefineRewrite replaces the matches of ValueRegexp in the value by
+	// Replacement, which can refer to submatches as $1.
+	DefineRewrite = "rewrite"
+	// DefinePin sets the value to Replacement, such as PACKAGE_NAME to a
+	// dummy name. The replacement can't be empty.
+	DefinePin = "pin"
+)
+
+// DefineRule is a rule for the defines that match it. The name of a define
+// is matched by either a glob (Name, with * and ?) or a regular expression
+// (NameRegexp), the value (after the =, empty if there is none) optionally
+// by Value or ValueRegexp in the same way. Regular expressions are not
+// anchored, globs must match as a whole.
+//
+// TargetSpecific marks rules for defines that the build system sets per
+// target (such as CMake's *_EXPORTS). Where target specific options are
+// noticed otherwise, these rules are only applied to the defines that don't
+// tell translation units apart (see ConsensusOptionsFromCommands and
+// ClusterByOptions).
+type DefineRule struct {
+	Action         string `json:"action"`
+	Name           string `json:"name,omitempty"`
+	NameRegexp     string `json:"name_regexp,omitempty"`
+	Value          string `json:"value,omitempty"`
+	ValueRegexp    string `json:"value_regexp,omitempty"`
+	Replacement    string `json:"replacement,omitempty"`
+	TargetSpecific bool   `json:"target_specific,omitempty"`
+
+	name  *regexp.Regexp
+	value *regexp.Regexp
+}
+
+// DefineRules is an ordered list of rules, of which the first one matching
+// a define decides what happens to it. Defines that match no rule are kept.
+type DefineRules struct {
+	rules []DefineRule
+}
+
+// globRegexp turns a glob into a regular expression matching it as a
+// whole. Unlike path.Match, * also matches slashes, as in values with
+// paths.
+func globRegexp(glob string) (*regexp.Regexp, error) {
+	expr := regexp.QuoteMeta(glob)
+	expr = strings.Replace(expr, `\*`, ".*", -1)
+	expr = strings.Replace(expr, `\?`, ".", -1)
+	return regexp.Compile("^" + expr + "$")
+}
+
+// compile checks a rule and compiles its patterns.
+func (r *DefineRule) compile() error {
+	switch r.Action {
+	case DefineDrop, DefineKeep, DefineRewrite, DefinePin:
+	default:
+		return fmt.Errorf("unknown action %q", r.Action)
+	}
+	var err error
+	switch {
+	case r.Name != "" && r.NameRegexp != "":
+		return fmt.Errorf("both name and name_regexp given")
+	case r.Name != "":
+		r.name, err = globRegexp(r.Name)
+	case r.NameRegexp != "":
+		r.name, err = regexp.Compile(r.NameRegexp)
+	default:
+		return fmt.Errorf("neither name nor name_regexp given")
+	}
+	if err != nil {
+		return err
+	}
+	switch {
+	case r.Value != "" && r.ValueRegexp != "":
+		return fmt.Errorf("both value and value_regexp given")
+	case r.Value != "":
+		r.value, err = globRegexp(r.Value)
+	case r.ValueRegexp != "":
+		r.value, err = regexp.Compile(r.ValueRegexp)
+	}
+	if err != nil {
+		return err
+	}
+	if r.Action == DefineRewrite && r.ValueRegexp == "" {
+		return fmt.Errorf("rewrite needs a value_regexp")
+	}
+	if r.Action == DefinePin && r.Replacement == "" {
+		return fmt.Errorf("pin needs a replacement")
+	}
+	return nil
+}
+
+// NewDefineRules checks the rules and prepares them for matching.
+func NewDefineRules(rules []DefineRule) (DefineRules, error) {
+	compiled := make([]DefineRule, len(rules))
+	for i, r := range rules {
+		if err := r.compile(); err != nil {
+			return DefineRules{}, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		compiled[i] = r
+	}
+	return DefineRules{rules: compiled}, nil
+}
+
+func mustDefineRules(rules []DefineRule) DefineRules {
+	r, err := NewDefineRules(rules)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// DefineRulePresets are the built-in rules.
+//   - "gaudi" drops the defines CMake and Gaudi set per target (*EXPORTS,
+//     GAUDI_LINKER_LIBRARY), and pins PACKAGE_NAME and PACKAGE_VERSION to
+//     dummy values, as they differ between the packages of a project
+//   - "none" keeps all defines
+var DefineRulePresets = map[string]DefineRules{
+	"gaudi": mustDefineRules([]DefineRule{
+		{Action: DefineDrop, Name: "*EXPORTS", TargetSpecific: true},
+		{Action: DefinePin, Name: "PACKAGE_NAME", Replacement: `"CompilerExplorer"`},
+		{Action: DefinePin, Name: "PACKAGE_VERSION", Replacement: `"v0r0"`},
+		{Action: DefineDrop, Name: "GAUDI_LINKER_LIBRARY", TargetSpecific: true},
+	}),
+	"none": {},
+}
+
+// DefaultDefineRules are the rules used when selecting compiler options
+// (see OptionsFromCommands).
+var DefaultDefineRules = DefineRulePresets["gaudi"]
+
+// defineRulesFile is the content of a rules file, see DefineRulesByBytes.
+type defineRulesFile struct {
+	Extends string       `json:"extends"`
+	Rules   []DefineRule `json:"rules"`
+}
+
+// DefineRulesByBytes reads rules from json of the form
+//
+//	{
+//	  "extends": "gaudi",
+//	  "rules": [
+//	    {"action": "keep", "name": "MYLIB_EXPORTS"},
+//	    {"action": "drop", "name_regexp": "^BUILD_"},
+//	    {"action": "rewrite", "name": "DATADIR", "value_regexp": "^/build/", "replacement": "/opt/"}
+//	  ]
+//	}
+//
+// where the optional extends names a preset (see DefineRulePresets) whose
+// rules are appended to those of the file.
+func DefineRulesByBytes(content []byte) (DefineRules, error) {
+	var file defineRulesFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return DefineRules{}, err
+	}
+	rules, err := NewDefineRules(file.Rules)
+	if err != nil {
+		return rules, err
+	}
+	if file.Extends != "" {
+		preset, found := DefineRulePresets[file.Extends]
+		if !found {
+			return rules, fmt.Errorf("unknown preset %q to extend", file.Extends)
+		}
+		rules.rules = append(rules.rules, preset.rules...)
+	}
+	return rules, nil
+}
+
+// DefineRulesByName returns the preset of that name, or reads the rules
+// from the file of that name (see DefineRulesByBytes).
+func DefineRulesByName(name string) (DefineRules, error) {
+	if preset, found := DefineRulePresets[name]; found {
+		return preset, nil
+	}
+	content, err := ioutil.ReadFile(name)
+	if err != nil {
+		return DefineRules{}, err
+	}
+	rules, err := DefineRulesByBytes(content)
+	if err != nil {
+		return rules, fmt.Errorf("%s: %w", name, err)
+	}
+	return rules, nil
+}
+
+// match returns the first rule matching a define, or nil.
+func (rs DefineRules) match(name, value string) *DefineRule {
+	for i := range rs.rules {
+		r := &rs.rules[i]
+		if !r.name.MatchString(name) {
+			continue
+		}
+		if r.value != nil && !r.value.MatchString(value) {
+			continue
+		}
+		return r
+	}
+	return nil
+}
+
+// apply applies the rules to a define (the argument of -D) and returns the
+// define to use, or false if it is dropped. Target specific rules are
+// skipped for defines for which keepTargetSpecific is true, pinned defines
+// are dropped if dropPinned is set.
+func (rs DefineRules) apply(define string, keepTargetSpecific func(string) bool, dropPinned bool) (string, bool) {
+	parts := strings.SplitN(define, "=", 2)
+	name, value := parts[0], ""
+	if len(parts) == 2 {
+		value = parts[1]
+	}
+	r := rs.match(name, value)
+	if r == nil {
+		return define, true
+	}
+	if r.TargetSpecific && keepTargetSpecific != nil && keepTargetSpecific(define) {
+		return define, true
+	}
+	switch r.Action {
+	case DefineDrop:
+		return "", false
+	case DefineRewrite:
+		return name + "=" + r.value.ReplaceAllString(value, r.Replacement), true
+	case DefinePin:
+		if dropPinned {
+			return "", false
+		}
+		return name + "=" + r.Replacement, true
+	}
+	return define, true
+}
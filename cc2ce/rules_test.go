@@ -0,0 +1,223 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+package cc2ce
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// applyDefineRules applies rules to a define, with "" for a dropped one.
+func applyDefineRules(rules DefineRules, define string) string {
+	got, keep := rules.apply(define, nil, false)
+	if !keep {
+		return ""
+	}
+	return got
+}
+
+func TestDefineRulesByName(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "rules.json")
+	content := `{
+  "extends": "gaudi",
+  "rules": [
+    {"action": "keep", "name": "MYLIB_EXPORTS"},
+    {"action": "pin", "name": "PACKAGE_VERSION", "replacement": "\"v9r9\""},
+    {"action": "drop", "name_regexp": "^BUILD_"},
+    {"action": "rewrite", "name": "DATADIR", "value_regexp": "^\"/build/(.*)\"$", "replacement": "\"/opt/$1\""}
+  ]
+}`
+	if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := DefineRulesByName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		define string
+		want   string
+	}{
+		// the rules of the file come before those of the preset
+		{"MYLIB_EXPORTS", "MYLIB_EXPORTS"},
+		{"OTHER_EXPORTS", ""},
+		{`PACKAGE_VERSION="v1r0"`, `PACKAGE_VERSION="v9r9"`},
+		{`PACKAGE_NAME="Brunel"`, `PACKAGE_NAME="CompilerExplorer"`},
+		{"GAUDI_LINKER_LIBRARY", ""},
+		{"BUILD_ID=42", ""},
+		{"MY_BUILD_ID=42", "MY_BUILD_ID=42"},
+		{`DATADIR="/build/share/data"`, `DATADIR="/opt/share/data"`},
+		{`DATADIR="/usr/share"`, `DATADIR="/usr/share"`},
+		{"NDEBUG", "NDEBUG"},
+	}
+	for _, tt := range tests {
+		if got := applyDefineRules(rules, tt.define); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.define, got, tt.want)
+		}
+	}
+
+	if rules, err := DefineRulesByName("none"); err != nil || applyDefineRules(rules, "FOO_EXPORTS") != "FOO_EXPORTS" {
+		t.Errorf("none preset: got %v", err)
+	}
+	if _, err := DefineRulesByName(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("no error for a missing rules file")
+	}
+}
+
+func TestDefineRulesOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  []DefineRule
+		define string
+		want   string
+	}{
+		{
+			name: "keep before drop",
+			rules: []DefineRule{
+				{Action: DefineKeep, Name: "FOO_EXPORTS"},
+				{Action: DefineDrop, Name: "*_EXPORTS"},
+			},
+			define: "FOO_EXPORTS",
+			want:   "FOO_EXPORTS",
+		},
+		{
+			name: "drop before keep",
+			rules: []DefineRule{
+				{Action: DefineDrop, Name: "*_EXPORTS"},
+				{Action: DefineKeep, Name: "FOO_EXPORTS"},
+			},
+			define: "FOO_EXPORTS",
+			want:   "",
+		},
+		{
+			name: "keep of another define",
+			rules: []DefineRule{
+				{Action: DefineKeep, Name: "FOO_EXPORTS"},
+				{Action: DefineDrop, Name: "*_EXPORTS"},
+			},
+			define: "BAR_EXPORTS",
+			want:   "",
+		},
+		{
+			name: "value decides",
+			rules: []DefineRule{
+				{Action: DefineKeep, Name: "LEVEL", Value: "1"},
+				{Action: DefineDrop, Name: "LEVEL"},
+			},
+			define: "LEVEL=2",
+			want:   "",
+		},
+		{
+			name: "value glob with slashes",
+			rules: []DefineRule{
+				{Action: DefineDrop, Name: "SRC", Value: "/build/*"},
+			},
+			define: "SRC=/build/a/b",
+			want:   "",
+		},
+		{
+			name: "no value matches an empty value",
+			rules: []DefineRule{
+				{Action: DefineDrop, Name: "X", ValueRegexp: "^$"},
+			},
+			define: "X",
+			want:   "",
+		},
+	}
+	for _, tt := range tests {
+		rules, err := NewDefineRules(tt.rules)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := applyDefineRules(rules, tt.define); got != tt.want {
+			t.Errorf("%s: %s: got %q, want %q", tt.name, tt.define, got, tt.want)
+		}
+	}
+}
+
+func TestDefineRulesRewrite(t *testing.T) {
+	rules, err := NewDefineRules([]DefineRule{
+		{Action: DefineRewrite, NameRegexp: "_DIR$", ValueRegexp: "/build/([^/:]+)", Replacement: "/opt/${1}-install"},
+		{Action: DefineRewrite, Name: "VERSION", ValueRegexp: `-dev$`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		define string
+		want   string
+	}{
+		{"DATA_DIR=/build/foo/share", "DATA_DIR=/opt/foo-install/share"},
+		// every match is replaced
+		{"PATH_DIR=/build/a:/build/b", "PATH_DIR=/opt/a-install:/opt/b-install"},
+		{"DATA_DIR=/usr/share", "DATA_DIR=/usr/share"},
+		// the value_regexp must match for the rule to apply
+		{"DATA_DIR", "DATA_DIR"},
+		// an empty replacement removes the match
+		{"VERSION=1.2-dev", "VERSION=1.2"},
+	}
+	for _, tt := range tests {
+		if got := applyDefineRules(rules, tt.define); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.define, got, tt.want)
+		}
+	}
+}
+
+func TestDefineRulesPinAndTargetSpecific(t *testing.T) {
+	rules := DefineRulePresets["gaudi"]
+	keep := func(define string) bool { return define == "FOO_EXPORTS" }
+	tests := []struct {
+		define     string
+		dropPinned bool
+		want       string
+	}{
+		{`PACKAGE_NAME="Brunel"`, false, `PACKAGE_NAME="CompilerExplorer"`},
+		{`PACKAGE_NAME="Brunel"`, true, ""},
+		{"FOO_EXPORTS", false, "FOO_EXPORTS"},
+		{"BAR_EXPORTS", false, ""},
+	}
+	for _, tt := range tests {
+		got, ok := rules.apply(tt.define, keep, tt.dropPinned)
+		if !ok {
+			got = ""
+		}
+		if got != tt.want {
+			t.Errorf("%s (drop pinned %v): got %q, want %q", tt.define, tt.dropPinned, got, tt.want)
+		}
+	}
+}
+
+func TestDefineRulesByBytesErrors(t *testing.T) {
+	tests := []struct {
+		content string
+		err     string
+	}{
+		{`{"rules": [{"action": "pin", "name": "PACKAGE_NAME"}]}`, "rule 1: pin needs a replacement"},
+		{`{"rules": [{"action": "keep", "name": "A"}, {"action": "rewrite", "name": "X", "replacement": "y"}]}`, "rule 2: rewrite needs a value_regexp"},
+		{`{"rules": [{"action": "rewrite", "name": "X", "value": "a*", "replacement": "y"}]}`, "rewrite needs a value_regexp"},
+		{`{"rules": [{"action": "zap", "name": "X"}]}`, `unknown action "zap"`},
+		{`{"rules": [{"action": "drop"}]}`, "neither name nor name_regexp given"},
+		{`{"rules": [{"action": "drop", "name": "X", "name_regexp": "X"}]}`, "both name and name_regexp given"},
+		{`{"rules": [{"action": "drop", "name": "X", "value": "1", "value_regexp": "1"}]}`, "both value and value_regexp given"},
+		{`{"rules": [{"action": "drop", "name_regexp": "("}]}`, "missing closing )"},
+		{`{"extends": "lhcb"}`, `unknown preset "lhcb" to extend`},
+		{`{"rules": {}}`, "cannot unmarshal"},
+	}
+	for _, tt := range tests {
+		if _, err := DefineRulesByBytes([]byte(tt.content)); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.content, err, tt.err)
+		}
+	}
+}
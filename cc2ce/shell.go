@@ -0,0 +1,159 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+// This file contains the splitting of the 'command' string of a
+// compile_commands.json entry into the argument list the compiler received.
+// CMake (and other generators) write that string such that a POSIX shell
+// would run it, so the quoting rules of a POSIX shell are followed here.
+// Variable expansion, globbing and command substitution are not performed.
+
+package cc2ce
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SplitCommand splits a shell command line into words the way a POSIX shell
+// would before running the command:
+//   - unquoted whitespace separates words
+//   - within single quotes, every character is taken literally
+//   - within double quotes, a backslash only escapes $, `, ", \ and newline
+//   - outside of quotes, a backslash escapes any character (and a
+//     backslash-newline pair is removed)
+//   - quotes are removed, an empty pair of quotes produces an empty word
+//
+// An error is returned for unterminated quotes and for a trailing backslash.
+func SplitCommand(command string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inword := false // needed to keep empty words from "" or ''
+
+	const (
+		unquoted = iota
+		singlequoted
+		doublequoted
+	)
+	state := unquoted
+
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch state {
+		case singlequoted:
+			if r == '\'' {
+				state = unquoted
+			} else {
+				word.WriteRune(r)
+			}
+		case doublequoted:
+			if r == '"' {
+				state = unquoted
+			} else if r == '\\' && i+1 < len(runes) && strings.ContainsRune("$`\"\\\n", runes[i+1]) {
+				i++
+				if runes[i] != '\n' {
+					word.WriteRune(runes[i])
+				}
+			} else {
+				word.WriteRune(r)
+			}
+		default:
+			switch r {
+			case ' ', '\t', '\n', '\r':
+				if inword {
+					words = append(words, word.String())
+					word.Reset()
+					inword = false
+				}
+			case '\'':
+				state = singlequoted
+				inword = true
+			case '"':
+				state = doublequoted
+				inword = true
+			case '\\':
+				if i+1 == len(runes) {
+					return words, fmt.Errorf("trailing backslash in command: %s", command)
+				}
+				i++
+				if runes[i] != '\n' {
+					word.WriteRune(runes[i])
+					inword = true
+				}
+			default:
+				word.WriteRune(r)
+				inword = true
+			}
+		}
+	}
+	if state == singlequoted {
+		return words, fmt.Errorf("unterminated single quote in command: %s", command)
+	}
+	if state == doublequoted {
+		return words, fmt.Errorf("unterminated double quote in command: %s", command)
+	}
+	if inword {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// QuoteArgument is the inverse of SplitCommand for a single word: words
+// containing whitespace, quotes, backslashes, $ or backticks, or nothing at
+// all are wrapped in single quotes, such that SplitCommand (and a shell)
+// gives back the word. For the options of a compiler in Compiler Explorer
+// see OptionArgument.
+func QuoteArgument(word string) string {
+	if word == "" {
+		return "''"
+	}
+	if !strings.ContainsAny(word, " \t\n\r'\"\\$`") {
+		return word
+	}
+	return "'" + strings.Replace(word, "'", `'\''`, -1) + "'"
+}
+
+// JoinArguments concatenates words with spaces, quoting where needed (see
+// QuoteArgument).
+func JoinArguments(words []string) string {
+	quoted := make([]string, 0, len(words))
+	for _, w := range words {
+		quoted = append(quoted, QuoteArgument(w))
+	}
+	return strings.Join(quoted, " ")
+}
+
+// OptionArgument quotes a word for the options of a compiler in the
+// .properties files: only words containing whitespace, single quotes or
+// nothing at all are wrapped in single quotes. Other words are returned
+// unchanged such that e.g. -DPACKAGE_NAME="Brunel" ends up in the
+// .properties files as is. Unlike QuoteArgument, this is not the inverse of
+// SplitCommand.
+func OptionArgument(word string) string {
+	if word == "" {
+		return "''"
+	}
+	if !strings.ContainsAny(word, " \t\n\r'") {
+		return word
+	}
+	return "'" + strings.Replace(word, "'", `'\''`, -1) + "'"
+}
+
+// JoinOptions concatenates words with spaces for the options of a compiler
+// in the .properties files, see OptionArgument.
+func JoinOptions(words []string) string {
+	quoted := make([]string, 0, len(words))
+	for _, w := range words {
+		quoted = append(quoted, OptionArgument(w))
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+package cc2ce
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{`g++ -c a.cpp`, []string{"g++", "-c", "a.cpp"}},
+		{"g++\t -c\n a.cpp ", []string{"g++", "-c", "a.cpp"}},
+		{`g++ -I"/path with spaces" -c a.cpp`, []string{"g++", "-I/path with spaces", "-c", "a.cpp"}},
+		{`g++ '-DX=a b' 'c\d'`, []string{"g++", "-DX=a b", `c\d`}},
+		{`g++ -DPACKAGE_NAME=\"Brunel\"`, []string{"g++", `-DPACKAGE_NAME="Brunel"`}},
+		{`g++ "-DX=\"v\"" "a\b" "\$HOME"`, []string{"g++", `-DX="v"`, `a\b`, "$HOME"}},
+		{`g++ a\ b`, []string{"g++", "a b"}},
+		{`g++ "" ''`, []string{"g++", "", ""}},
+		{"g++ -c \\\na.cpp", []string{"g++", "-c", "a.cpp"}},
+		{`g++ $HOME`, []string{"g++", "$HOME"}},
+		{``, nil},
+	}
+	for _, tt := range tests {
+		got, err := SplitCommand(tt.command)
+		if err != nil {
+			t.Errorf("SplitCommand(%q) error: %v", tt.command, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitCommand(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestSplitCommandErrors(t *testing.T) {
+	for _, command := range []string{`g++ "-DX`, `g++ '-DX`, `g++ -c a.cpp\`} {
+		if _, err := SplitCommand(command); err == nil {
+			t.Errorf("SplitCommand(%q) gave no error", command)
+		}
+	}
+}
+
+func TestQuoteArgumentRoundTrip(t *testing.T) {
+	words := []string{"g++", "", "a b", "it's", `-DX="v"`, `a\b`, "$HOME", "`pwd`", "tab\there"}
+	got, err := SplitCommand(JoinArguments(words))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, words) {
+		t.Errorf("SplitCommand(JoinArguments(%q)) = %q", words, got)
+	}
+}
+
+func TestJoinOptions(t *testing.T) {
+	got := JoinOptions([]string{`-DPACKAGE_NAME="Brunel"`, "-DX=a b", "-O2"})
+	if want := `-DPACKAGE_NAME="Brunel" '-DX=a b' -O2`; got != want {
+		t.Errorf("JoinOptions() = %s, want %s", got, want)
+	}
+}
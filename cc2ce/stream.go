@@ -0,0 +1,231 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+// This file contains the streaming decoding of a compilation database: one
+// translation unit is decoded at a time, such that databases of hundreds of
+// megabytes can be processed without holding them in memory.
+
+package cc2ce
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// lineTracker wraps the input of a json.Decoder and keeps the bytes that
+// the decoder may still report errors for, such that byte offsets can be
+// turned into line and column. Everything before the position passed to
+// forget is discarded, only the number of lines in it is kept.
+type lineTracker struct {
+	r           io.Reader
+	start       int64  // offset of buf[0] in the stream
+	buf         []byte // data from start up to what has been read
+	lines       int    // newlines before start
+	lastNewline int64  // offset of the last newline before start, -1 if none
+}
+
+func newLineTracker(r io.Reader) *lineTracker {
+	return &lineTracker{r: r, lastNewline: -1}
+}
+
+func (t *lineTracker) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	t.buf = append(t.buf, p[:n]...)
+	return n, err
+}
+
+// forget drops the data before offset.
+func (t *lineTracker) forget(offset int64) {
+	drop := offset - t.start
+	if drop <= 0 {
+		return
+	}
+	if drop > int64(len(t.buf)) {
+		drop = int64(len(t.buf))
+	}
+	dropped := t.buf[:drop]
+	t.lines += bytes.Count(dropped, []byte("\n"))
+	if i := bytes.LastIndexByte(dropped, '\n'); i >= 0 {
+		t.lastNewline = t.start + int64(i)
+	}
+	t.buf = append(t.buf[:0], t.buf[drop:]...)
+	t.start += drop
+}
+
+// position converts a byte offset into line and column (both starting at
+// 1). Offsets before what has been forgotten are reported at the first
+// retained byte.
+func (t *lineTracker) position(offset int64) (int, int) {
+	if offset < t.start {
+		offset = t.start
+	}
+	if offset > t.start+int64(len(t.buf)) {
+		offset = t.start + int64(len(t.buf))
+	}
+	before := t.buf[:offset-t.start]
+	line := t.lines + bytes.Count(before, []byte("\n")) + 1
+	lastNewline := t.lastNewline
+	if i := bytes.LastIndexByte(before, '\n'); i >= 0 {
+		lastNewline = t.start + int64(i)
+	}
+	return line, int(offset - lastNewline)
+}
+
+// skipSeparators advances offset over whitespace and commas, as far as the
+// retained data allows.
+func (t *lineTracker) skipSeparators(offset int64) int64 {
+	for offset >= t.start && offset < t.start+int64(len(t.buf)) && strings.IndexByte(", \t\r\n", t.buf[offset-t.start]) >= 0 {
+		offset++
+	}
+	return offset
+}
+
+// jsonError turns an error of encoding/json into a *SyntaxError, where
+// base is the offset at which the decoded value started.
+func (t *lineTracker) jsonError(base int64, err error) error {
+	var syntax *json.SyntaxError
+	var typeerr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntax):
+		// Offset counts the offending byte
+		line, column := t.position(syntax.Offset - 1)
+		return &SyntaxError{Line: line, Column: column, Msg: syntax.Error()}
+	case errors.As(err, &typeerr):
+		line, column := t.position(base + typeerr.Offset)
+		return &SyntaxError{Line: line, Column: column, Msg: typeerr.Error()}
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		line, column := t.position(t.start + int64(len(t.buf)))
+		return &SyntaxError{Line: line, Column: column, Msg: "unexpected end of input (truncated file?)"}
+	}
+	return err
+}
+
+// errStopVisiting can be returned by a visitor to end the iteration early
+// without error.
+var errStopVisiting = errors.New("stop visiting translation units")
+
+// streamDatabase is the implementation of VisitJsonTUs, when checkCommands
+// is true, the compiler calls get parsed as well (see ValidateJsonByBytes).
+func streamDatabase(r io.Reader, checkCommands bool, visit func(JsonTranslationunit) error) error {
+	var problems ValidationErrors
+
+	tracker := newLineTracker(r)
+	dec := json.NewDecoder(tracker)
+	tok, err := dec.Token()
+	if err != nil {
+		return tracker.jsonError(0, err)
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		// InputOffset points behind the token, report where it starts
+		line, column := tracker.position(tracker.skipSeparators(0))
+		return &SyntaxError{Line: line, Column: column, Msg: "compilation database must be a json array"}
+	}
+	for index := 0; dec.More(); index++ {
+		offset := dec.InputOffset()
+		tracker.forget(offset)
+		var raw map[string]json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return tracker.jsonError(offset, err)
+		}
+		// InputOffset points behind the previous entry, skip the separator
+		line, _ := tracker.position(tracker.skipSeparators(offset))
+		tu, entryproblems := decodeEntry(raw)
+		if checkCommands && len(entryproblems) == 0 {
+			if _, err := ParseCompileCommand(tu); err != nil {
+				entryproblems = append(entryproblems, err)
+			}
+		}
+		for _, p := range entryproblems {
+			problems = append(problems, &EntryError{Index: index, Line: line, File: tu.File, Err: p})
+		}
+		if len(entryproblems) == 0 {
+			if err := visit(tu); err == errStopVisiting {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return tracker.jsonError(dec.InputOffset(), err)
+	}
+
+	if len(problems) != 0 {
+		return problems
+	}
+	return nil
+}
+
+// VisitJsonTUs decodes a compilation database from r one translation unit at
+// a time and calls visit for each of them. Only the entry being decoded is
+// held in memory. If visit returns an error, the iteration stops and the
+// error is returned.
+//
+// Problems are reported as by JsonTUsByBytes. Malformed json stops the
+// iteration, entries with missing fields are skipped and reported at the
+// end.
+func VisitJsonTUs(r io.Reader, visit func(JsonTranslationunit) error) error {
+	return streamDatabase(r, false, visit)
+}
+
+// VisitCompileCommands is VisitJsonTUs with parsed compiler calls.
+func VisitCompileCommands(r io.Reader, visit func(CompileCommand) error) error {
+	return VisitJsonTUs(r, func(tu JsonTranslationunit) error {
+		cc, err := ParseCompileCommand(tu)
+		if err != nil {
+			return fmt.Errorf("%s: %w", tu.File, err)
+		}
+		return visit(cc)
+	})
+}
+
+// IncludesFromReader is IncludesFromJsonByBytes for a streamed database.
+func IncludesFromReader(r io.Reader, turnAbsolute bool) (IncludeSet, error) {
+	var includes IncludeSet
+	err := VisitCompileCommands(r, func(cc CompileCommand) error {
+		includes.AddTranslationUnit(cc.IncludePaths(turnAbsolute))
+		return nil
+	})
+	return includes, err
+}
+
+// OptionsFromReader is OptionsFromJsonByBytes for a streamed database. Only
+// the database up to the first translation unit is read.
+func OptionsFromReader(r io.Reader, skippackagenameversion bool) (string, error) {
+	var first []CompileCommand
+	err := VisitCompileCommands(r, func(cc CompileCommand) error {
+		first = append(first, cc)
+		return errStopVisiting
+	})
+	if err != nil {
+		return "", err
+	}
+	return OptionsFromCommands(first, skippackagenameversion)
+}
+
+// ConsensusOptionsFromReader is ConsensusOptionsFromCommands for a streamed
+// database.
+func ConsensusOptionsFromReader(r io.Reader, threshold float64, skippackagenameversion bool) (OptionConsensus, error) {
+	counter := newConsensusCounter(skippackagenameversion)
+	err := VisitCompileCommands(r, func(cc CompileCommand) error {
+		counter.add(cc)
+		return nil
+	})
+	if err != nil {
+		return OptionConsensus{}, err
+	}
+	return counter.result(threshold)
+}
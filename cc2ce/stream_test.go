@@ -0,0 +1,180 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+package cc2ce
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// streamEntries is the number of translation units of generateDatabase.
+const streamEntries = 20000
+
+// generateDatabase writes a database of streamEntries translation units,
+// where entry i starts at line 2+5*i. edit can change the text of an entry.
+func generateDatabase(edit func(i int, entry string) string) []byte {
+	var b bytes.Buffer
+	b.WriteString("[\n")
+	for i := 0; i < streamEntries; i++ {
+		file := fmt.Sprintf("src/f%05d.cpp", i)
+		entry := fmt.Sprintf("  {\n    \"directory\": \"/build\",\n    \"file\": %q,\n    \"command\": \"g++ -I/inc/%d -DN=%d -c %s\"\n  }", file, i%10, i, file)
+		if edit != nil {
+			entry = edit(i, entry)
+		}
+		b.WriteString(entry)
+		if i+1 < streamEntries {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("]\n")
+	return b.Bytes()
+}
+
+// visitFiles streams a database in small reads and returns the files of
+// the visited translation units.
+func visitFiles(content []byte) ([]string, error) {
+	var files []string
+	err := VisitJsonTUs(iotest.HalfReader(bytes.NewReader(content)), func(tu JsonTranslationunit) error {
+		files = append(files, tu.File)
+		return nil
+	})
+	return files, err
+}
+
+func TestVisitJsonTUsOrder(t *testing.T) {
+	files, err := visitFiles(generateDatabase(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != streamEntries {
+		t.Fatalf("visited %d translation units, want %d", len(files), streamEntries)
+	}
+	for i, f := range files {
+		if want := fmt.Sprintf("src/f%05d.cpp", i); f != want {
+			t.Fatalf("visit %d: got %s, want %s", i, f, want)
+		}
+	}
+
+	// a visitor error stops the iteration
+	stop := errors.New("enough")
+	visited := 0
+	err = VisitJsonTUs(bytes.NewReader(generateDatabase(nil)), func(tu JsonTranslationunit) error {
+		visited++
+		if tu.File == "src/f00500.cpp" {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || visited != 501 {
+		t.Errorf("got %v after %d visits, want %v after 501", err, visited, stop)
+	}
+}
+
+func TestVisitJsonTUsErrorPosition(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		line    int
+		column  int
+		msg     string
+		visited int
+	}{
+		{
+			name: "missing colon",
+			content: generateDatabase(func(i int, entry string) string {
+				if i == 12345 {
+					return strings.Replace(entry, `"file":`, `"file"`, 1)
+				}
+				return entry
+			}),
+			line:    2 + 5*12345 + 2,
+			column:  12,
+			msg:     "after object key",
+			visited: 12345,
+		},
+		{
+			name: "wrong type",
+			content: generateDatabase(func(i int, entry string) string {
+				if i == 17000 {
+					return strings.Replace(entry, `"directory": "/build"`, `"directory": ["/build"]`, 1)
+				}
+				return entry
+			}),
+			// reported at the start of the entry
+			line: 2 + 5*17000,
+			msg:  "field directory",
+			// the entry is skipped and reported at the end
+			visited: streamEntries - 1,
+		},
+		{
+			// in the file name of the last entry, reported behind its last byte
+			name:    "truncated",
+			content: generateDatabase(nil)[:len(generateDatabase(nil))-len("pp\"\n  }\n]\n")],
+			line:    2 + 5*(streamEntries-1) + 3,
+			column:  len(`    "command": "g++ -I/inc/9 -DN=19999 -c src/f19999.c`) + 1,
+			msg:     "unexpected end of input",
+			visited: streamEntries - 1,
+		},
+	}
+	for _, tt := range tests {
+		files, err := visitFiles(tt.content)
+		if len(files) != tt.visited {
+			t.Errorf("%s: visited %d translation units, want %d", tt.name, len(files), tt.visited)
+		}
+		var syntax *SyntaxError
+		var entry *EntryError
+		switch {
+		case errors.As(err, &syntax):
+			if syntax.Line != tt.line || syntax.Column != tt.column || !strings.Contains(syntax.Msg, tt.msg) {
+				t.Errorf("%s: got %v, want line %d, column %d: %s", tt.name, err, tt.line, tt.column, tt.msg)
+			}
+		case errors.As(err, &entry):
+			if entry.Line != tt.line || !strings.Contains(entry.Error(), tt.msg) {
+				t.Errorf("%s: got %v, want line %d: %s", tt.name, err, tt.line, tt.msg)
+			}
+		default:
+			t.Errorf("%s: got error %v, want one at line %d", tt.name, err, tt.line)
+		}
+	}
+}
+
+func TestIncludesFromReaderStreamed(t *testing.T) {
+	includes, err := IncludesFromReader(iotest.HalfReader(bytes.NewReader(generateDatabase(nil))), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []IncludePath
+	for i := 0; i < 10; i++ {
+		want = append(want, IncludePath{Path: fmt.Sprintf("/inc/%d", i), Kind: IncludeUser, Uses: streamEntries / 10})
+	}
+	if got := includes.Entries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	content := generateDatabase(func(i int, entry string) string {
+		if i == 42 {
+			return strings.Replace(entry, `"command"`, `"command" ::`, 1)
+		}
+		return entry
+	})
+	var syntax *SyntaxError
+	if _, err := IncludesFromReader(bytes.NewReader(content), false); !errors.As(err, &syntax) || syntax.Line != 2+5*42+3 {
+		t.Errorf("got error %v, want one at line %d", err, 2+5*42+3)
+	}
+}
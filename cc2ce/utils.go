@@ -13,7 +13,7 @@
 package cc2ce
 
 import (
-	"bytes"
+	"sort"
 	"strings"
 )
 
@@ -25,17 +25,14 @@ func ColonSeparateArray(stringset []string) string {
 }
 
 // Convert a quasi-set of strings (a map[string]bool) into a colon separated string.
-// Only the map keys are considered, values are ignored.
+// Only the map keys are considered, values are ignored. The keys are sorted
+// to get the same output on every call. Where the order matters (such as
+// for include paths), use an IncludeSet instead.
 func ColonSeparateMap(stringset map[string]bool) string {
-	var b bytes.Buffer
-	addseparator := false
-	for k, _ := range stringset {
-		if addseparator {
-			b.WriteString(":")
-		} else {
-			addseparator = true
-		}
-		b.WriteString(k)
+	keys := make([]string, 0, len(stringset))
+	for k := range stringset {
+		keys = append(keys, k)
 	}
-	return b.String()
+	sort.Strings(keys)
+	return strings.Join(keys, ":")
 }
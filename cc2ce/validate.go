@@ -0,0 +1,154 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+// This file contains the checking of a compilation database. A truncated or
+// otherwise broken compile_commands.json must not result in an empty (but
+// successfully written) configuration.
+
+package cc2ce
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// SyntaxError is malformed JSON in a compilation database. Line and Column
+// start at 1.
+type SyntaxError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("malformed json at line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+// MissingFieldError is a database entry without a required field.
+type MissingFieldError struct {
+	Field string
+}
+
+func (e *MissingFieldError) Error() string {
+	return fmt.Sprintf("missing required field %s", e.Field)
+}
+
+// DanglingArgumentError is a flag at the end of a compiler call which needs
+// an argument (such as a trailing -isystem).
+type DanglingArgumentError struct {
+	Flag string
+}
+
+func (e *DanglingArgumentError) Error() string {
+	return fmt.Sprintf("missing argument to %s", e.Flag)
+}
+
+// EntryError locates a problem at an entry of the database.
+//   - Index is the position of the entry in the database, starting at 0
+//   - Line is the line at which the entry starts
+//   - File is the file field of the entry (if present)
+type EntryError struct {
+	Index int
+	Line  int
+	File  string
+	Err   error
+}
+
+func (e *EntryError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("entry %d (line %d): %v", e.Index, e.Line, e.Err)
+	}
+	return fmt.Sprintf("entry %d (line %d, %s): %v", e.Index, e.Line, e.File, e.Err)
+}
+
+func (e *EntryError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationErrors collects all problems found in a database.
+type ValidationErrors []error
+
+func (e ValidationErrors) Unwrap() []error {
+	return e
+}
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d problem(s) in compilation database: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// decodeEntry decodes a single database entry and checks that the required
+// fields are present: directory, file, and command or arguments.
+func decodeEntry(raw map[string]json.RawMessage) (JsonTranslationunit, []error) {
+	var tu JsonTranslationunit
+	var problems []error
+	for _, field := range []string{"directory", "file"} {
+		if _, found := raw[field]; !found {
+			problems = append(problems, &MissingFieldError{Field: field})
+		}
+	}
+	_, hascommand := raw["command"]
+	_, hasarguments := raw["arguments"]
+	if !hascommand && !hasarguments {
+		problems = append(problems, &MissingFieldError{Field: "command or arguments"})
+	}
+
+	fields := []struct {
+		name   string
+		target interface{}
+	}{
+		{"directory", &tu.Builddir},
+		{"command", &tu.Command},
+		{"file", &tu.File},
+		{"arguments", &tu.Arguments},
+		{"output", &tu.Output},
+	}
+	for _, f := range fields {
+		if value, found := raw[f.name]; found {
+			if err := json.Unmarshal(value, f.target); err != nil {
+				problems = append(problems, fmt.Errorf("field %s: %v", f.name, err))
+			}
+		}
+	}
+	return tu, problems
+}
+
+// decodeDatabase decodes a complete compilation database, see
+// streamDatabase.
+func decodeDatabase(content []byte, checkCommands bool) ([]JsonTranslationunit, error) {
+	var db []JsonTranslationunit
+	err := streamDatabase(bytes.NewReader(content), checkCommands, func(tu JsonTranslationunit) error {
+		db = append(db, tu)
+		return nil
+	})
+	return db, err
+}
+
+// ValidateJsonByBytes checks a compilation database and reports all
+// problems found:
+//   - malformed json as *SyntaxError with line and column
+//   - entries without directory, file, or command/arguments as
+//     *MissingFieldError
+//   - compiler calls ending in a flag that needs an argument as
+//     *DanglingArgumentError
+//
+// Problems of entries are wrapped in *EntryError and collected in
+// ValidationErrors, use errors.As to get to the specific error types.
+func ValidateJsonByBytes(inFileContent []byte) error {
+	_, err := decodeDatabase(inFileContent, true)
+	return err
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+package cc2ce
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateJsonByBytesSyntax(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		line, column int
+	}{
+		{
+			name:    "missing comma",
+			content: "[\n  {\"directory\": \"/b\", \"file\": \"a.cpp\", \"command\": \"g++ -c a.cpp\"},\n  {\"directory\": \"/b\" \"file\": \"b.cpp\"}\n]",
+			line:    3,
+			column:  22,
+		},
+		{
+			name:    "truncated",
+			content: "[\n  {\"directory\": \"/b\",\n   \"file\": \"a.cpp\",\n   \"command\": \"g++ -c a.cpp\",\n",
+			line:    5,
+			column:  1,
+		},
+		{
+			name:    "not an array",
+			content: "\n  {}",
+			line:    2,
+			column:  3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateJsonByBytes([]byte(tt.content))
+			var syntax *SyntaxError
+			if !errors.As(err, &syntax) {
+				t.Fatalf("ValidateJsonByBytes() error = %v, want a *SyntaxError", err)
+			}
+			if syntax.Line != tt.line || syntax.Column != tt.column {
+				t.Errorf("error at line %d, column %d, want line %d, column %d", syntax.Line, syntax.Column, tt.line, tt.column)
+			}
+		})
+	}
+}
+
+func TestValidateJsonByBytesEntries(t *testing.T) {
+	content := "[\n" +
+		"  {\"directory\": \"/b\", \"file\": \"a.cpp\", \"command\": \"g++ -c a.cpp\"},\n" +
+		"  {\"directory\": \"/b\", \"file\": \"b.cpp\"},\n" +
+		"  {\"file\": \"c.cpp\", \"command\": \"g++ -c c.cpp\"},\n" +
+		"  {\"directory\": \"/b\", \"file\": \"d.cpp\", \"command\": \"g++ -c d.cpp -isystem\"}\n" +
+		"]"
+	err := ValidateJsonByBytes([]byte(content))
+	var problems ValidationErrors
+	if !errors.As(err, &problems) {
+		t.Fatalf("ValidateJsonByBytes() error = %v, want ValidationErrors", err)
+	}
+	want := []struct {
+		index, line int
+		file        string
+	}{
+		{1, 3, "b.cpp"},
+		{2, 4, "c.cpp"},
+		{3, 5, "d.cpp"},
+	}
+	if len(problems) != len(want) {
+		t.Fatalf("got %d problems, want %d: %v", len(problems), len(want), err)
+	}
+	for i, w := range want {
+		var entry *EntryError
+		if !errors.As(problems[i], &entry) {
+			t.Fatalf("problem %d is %v, want an *EntryError", i, problems[i])
+		}
+		if entry.Index != w.index || entry.Line != w.line || entry.File != w.file {
+			t.Errorf("problem %d at entry %d, line %d, file %s, want entry %d, line %d, file %s", i, entry.Index, entry.Line, entry.File, w.index, w.line, w.file)
+		}
+	}
+
+	var missing *MissingFieldError
+	if !errors.As(problems[1], &missing) || missing.Field != "directory" {
+		t.Errorf("problem 1 is %v, want missing directory", problems[1])
+	}
+	var dangling *DanglingArgumentError
+	if !errors.As(problems[2], &dangling) || dangling.Flag != "-isystem" {
+		t.Errorf("problem 2 is %v, want missing argument to -isystem", problems[2])
+	}
+}
+
+func TestValidateJsonByBytesValid(t *testing.T) {
+	for _, content := range []string{"[]", " [\n] ", `[{"directory": "/b", "file": "a.cpp", "arguments": ["g++", "-c", "a.cpp"]}]`} {
+		if err := ValidateJsonByBytes([]byte(content)); err != nil {
+			t.Errorf("ValidateJsonByBytes(%q) = %v", content, err)
+		}
+	}
+}
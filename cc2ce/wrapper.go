@@ -0,0 +1,304 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+// This file contains the resolution of compiler wrapper scripts (such as the
+// lcg-g++-X.Y.Z scripts of LCG) which set up the environment and then run
+// the real compiler. The scripts are read, not run.
+
+package cc2ce
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// WrapperResolution is a wrapper script resolved to what it runs.
+//   - Wrappers are the scripts that were resolved, outermost first
+//   - Compiler is the compiler that gets run in the end
+//   - Args are arguments the wrappers pass to the compiler before the
+//     arguments they were called with
+//   - Env are the VAR=value settings the wrappers make, in order
+type WrapperResolution struct {
+	Wrappers []string
+	Compiler string
+	Args     []string
+	Env      []string
+}
+
+// maxWrapperDepth limits how many wrapper scripts calling each other are
+// resolved.
+const maxWrapperDepth = 8
+
+// shellInterpreters are the interpreters of scripts which get resolved.
+var shellInterpreters = map[string]bool{"sh": true, "bash": true, "dash": true, "ksh": true, "zsh": true}
+
+// scriptDirRe matches the usual ways for a script to refer to its own
+// directory.
+var scriptDirRe = regexp.MustCompile(`\$\(\s*dirname\s+"?\$0"?\s*\)|` + "`dirname \"?\\$0\"?`" + `|\$\{0%/\*\}`)
+
+// shellVariableRe matches $VAR, ${VAR}, ${VAR:-word} and ${VAR:+word}.
+var shellVariableRe = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:[-+][^}]*)?\}|\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+// shellScriptLines returns the lines of a shell script without comments
+// and the shebang, or false if the file is not a shell script.
+func shellScriptLines(content []byte) ([]string, bool) {
+	if !bytes.HasPrefix(content, []byte("#!")) {
+		return nil, false
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Scan()
+	shebang := strings.Fields(strings.TrimPrefix(scanner.Text(), "#!"))
+	if len(shebang) == 0 {
+		return nil, false
+	}
+	interpreter := filepath.Base(shebang[0])
+	if interpreter == "env" && len(shebang) > 1 {
+		interpreter = shebang[1]
+	}
+	if !shellInterpreters[interpreter] {
+		return nil, false
+	}
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, true
+}
+
+// expandShellVariables expands variable references in a word. Variables
+// not set by the script expand to nothing, as the environment in which the
+// compiler will be run is not known.
+func expandShellVariables(word string, vars map[string]string) string {
+	return shellVariableRe.ReplaceAllStringFunc(word, func(ref string) string {
+		m := shellVariableRe.FindStringSubmatch(ref)
+		name := m[1]
+		if name == "" {
+			name = m[3]
+		}
+		value := vars[name]
+		if m[2] != "" {
+			alternative := expandShellVariables(m[2][2:], vars)
+			if (m[2][1] == '+') == (value != "") {
+				return alternative
+			}
+		}
+		return value
+	})
+}
+
+// cleanPathList removes the empty entries that expanding unset variables
+// leaves in colon separated lists.
+func cleanPathList(value string) string {
+	if !strings.Contains(value, ":") {
+		return value
+	}
+	var entries []string
+	for _, e := range strings.Split(value, ":") {
+		if e != "" {
+			entries = append(entries, e)
+		}
+	}
+	return strings.Join(entries, ":")
+}
+
+// setEnv sets a variable in an ordered VAR=value list.
+func setEnv(env []string, name, value string) []string {
+	for i, e := range env {
+		if strings.HasPrefix(e, name+"=") {
+			return append(append(env[:i:i], env[i+1:]...), name+"="+value)
+		}
+	}
+	return append(env, name+"="+value)
+}
+
+// parseWrapperScript interprets a wrapper script consisting of variable
+// assignments (with or without export), unset, set, and a final command
+// that passes on its arguments ("$@"). Scripts with anything else (if,
+// case, functions, ...) are not recognised.
+func parseWrapperScript(path string, lines []string, env []string) (string, []string, []string, bool) {
+	vars := make(map[string]string)
+	for _, e := range env {
+		eq := strings.Index(e, "=")
+		vars[e[:eq]] = e[eq+1:]
+	}
+	dir := filepath.Dir(path)
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	for n, line := range lines {
+		line = scriptDirRe.ReplaceAllLiteralString(line, dir)
+		words, err := SplitCommand(line)
+		if err != nil || len(words) == 0 {
+			return "", nil, nil, false
+		}
+		switch words[0] {
+		case "set", "unset":
+			if words[0] == "unset" {
+				for _, name := range words[1:] {
+					delete(vars, name)
+					for i, e := range env {
+						if strings.HasPrefix(e, name+"=") {
+							env = append(env[:i:i], env[i+1:]...)
+							break
+						}
+					}
+				}
+			}
+			continue
+		case "exec":
+			words = words[1:]
+			if len(words) == 0 {
+				return "", nil, nil, false
+			}
+		}
+		exported := words[0] == "export"
+		if exported || isEnvAssignment(words[0]) {
+			if exported {
+				words = words[1:]
+			}
+			for _, w := range words {
+				if !isEnvAssignment(w) && !(exported && !strings.Contains(w, "=")) {
+					return "", nil, nil, false
+				}
+			}
+			for _, w := range words {
+				eq := strings.Index(w, "=")
+				if eq < 0 {
+					// export of a variable set before
+					continue
+				}
+				name := w[:eq]
+				value := cleanPathList(expandShellVariables(w[eq+1:], vars))
+				vars[name] = value
+				env = setEnv(env, name, value)
+			}
+			continue
+		}
+		// the command which runs the compiler must be the last one
+		if n != len(lines)-1 || words[len(words)-1] != "$@" {
+			return "", nil, nil, false
+		}
+		var args []string
+		for _, w := range words[1 : len(words)-1] {
+			args = append(args, expandShellVariables(w, vars))
+		}
+		return expandShellVariables(words[0], vars), args, env, true
+	}
+	return "", nil, nil, false
+}
+
+// maxScriptSize is the size up to which files are read as wrapper scripts.
+const maxScriptSize = 64 * 1024
+
+// readScript reads a file if it is a script (starts with #!) of reasonable
+// size, and returns nothing for other files (such as compiler binaries).
+func readScript(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	content, err := ioutil.ReadAll(io.LimitReader(f, maxScriptSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > maxScriptSize || !bytes.HasPrefix(content, []byte("#!")) {
+		return nil, nil
+	}
+	return content, nil
+}
+
+// ResolveCompilerWrapper reads a compiler executable and, if it is a
+// wrapper script, resolves it to the compiler it runs and the environment
+// it sets up for that (also through several wrappers calling each other).
+// Common wrappers such as the LCG lcg-g++-X.Y.Z scripts look like
+//
+//	#!/bin/sh
+//	export LD_LIBRARY_PATH=/path/to/gcc/lib64${LD_LIBRARY_PATH:+:$LD_LIBRARY_PATH}
+//	export COMPILER_PATH=/path/to/binutils/bin
+//	exec /path/to/gcc/bin/g++ "$@"
+//
+// References to variables not set in the scripts expand to nothing. A
+// compiler run by a relative path (other than one starting from the
+// script's directory, such as $(dirname $0)/bin/g++) is an error, as it
+// depends on the working directory. The boolean return is false if
+// compiler is not a recognised wrapper.
+func ResolveCompilerWrapper(compiler string) (WrapperResolution, bool, error) {
+	var res WrapperResolution
+	current := compiler
+	for depth := 0; depth < maxWrapperDepth; depth++ {
+		content, err := readScript(current)
+		if err != nil {
+			if depth == 0 {
+				return res, false, err
+			}
+			return res, false, fmt.Errorf("%s (run by %s): %w", current, res.Wrappers[len(res.Wrappers)-1], err)
+		}
+		lines, isScript := shellScriptLines(content)
+		if !isScript {
+			break
+		}
+		next, args, env, recognised := parseWrapperScript(current, lines, res.Env)
+		if !recognised {
+			break
+		}
+		res.Wrappers = append(res.Wrappers, current)
+		res.Args = append(args, res.Args...)
+		res.Env = env
+		if !strings.Contains(next, "/") {
+			// the script runs a compiler from the PATH it set up
+			path, err := CompileCommand{Compiler: next, Env: env}.CompilerPath()
+			if err != nil {
+				return res, false, fmt.Errorf("%s: %w", current, err)
+			}
+			next = path
+		} else if !filepath.IsAbs(next) {
+			// the shell resolves it against the working directory of
+			// whoever runs the compiler, which Compiler Explorer doesn't
+			// share (paths relative to the script use $(dirname $0))
+			return res, false, fmt.Errorf("%s: runs %s relative to the working directory", current, next)
+		}
+		current = next
+	}
+	if len(res.Wrappers) == 0 {
+		return res, false, nil
+	}
+	if _, err := os.Stat(current); err != nil {
+		return res, false, fmt.Errorf("%s: %w", res.Wrappers[len(res.Wrappers)-1], err)
+	}
+	res.Compiler = current
+	return res, true, nil
+}
+
+// EnvVars returns the environment as envVars setting for a compiler in
+// Compiler Explorer. As Compiler Explorer separates the variables with
+// colons, values with colons (such as a LD_LIBRARY_PATH with several
+// directories) can't be expressed and are reported as error.
+func (r WrapperResolution) EnvVars() (string, error) {
+	for _, e := range r.Env {
+		if strings.Contains(e[strings.Index(e, "=")+1:], ":") {
+			return "", fmt.Errorf("%s can't be passed in envVars, which are colon separated", e)
+		}
+	}
+	return ColonSeparateArray(r.Env), nil
+}
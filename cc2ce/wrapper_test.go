@@ -0,0 +1,65 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+package cc2ce
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeWrapper creates a wrapper script next to a (fake) compiler in
+// gcc/bin/g++ and returns the path of the script.
+func writeWrapper(t *testing.T, script string) string {
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "gcc", "bin")
+	if err := os.MkdirAll(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(bin, "g++"), []byte{0x7f, 'E', 'L', 'F'}, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "g++")
+	if err := ioutil.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestResolveCompilerWrapperScriptDir(t *testing.T) {
+	for _, script := range []string{
+		"#!/bin/sh\nexec $(dirname $0)/gcc/bin/g++ \"$@\"\n",
+		"#!/bin/sh\nexec \"`dirname $0`/gcc/bin/g++\" \"$@\"\n",
+		"#!/bin/sh\nexec ${0%/*}/gcc/bin/g++ \"$@\"\n",
+	} {
+		path := writeWrapper(t, script)
+		res, found, err := ResolveCompilerWrapper(path)
+		if err != nil || !found {
+			t.Errorf("%q: got %v, %v", script, found, err)
+			continue
+		}
+		if want := filepath.Join(filepath.Dir(path), "gcc", "bin", "g++"); res.Compiler != want {
+			t.Errorf("%q: got %s, want %s", script, res.Compiler, want)
+		}
+	}
+}
+
+func TestResolveCompilerWrapperRelativePath(t *testing.T) {
+	// the shell runs this relative to the caller's working directory, not
+	// to the script's
+	path := writeWrapper(t, "#!/bin/sh\nexec gcc/bin/g++ \"$@\"\n")
+	if _, found, err := ResolveCompilerWrapper(path); err == nil || found {
+		t.Errorf("got %v, %v for a compiler relative to the working directory", found, err)
+	}
+}
@@ -24,8 +24,8 @@ import (
 	"github.com/pseyfert/compilecommands_to_compilerexplorer/cc2ce"
 )
 
-// Filter_LHCb_public_includes removes or manipulates include paths from a
-// map[string]bool that need special treatment in the setup of the LHCb build
+// Filter_LHCb_public_includes removes or manipulates include paths from an
+// IncludeSet that need special treatment in the setup of the LHCb build
 // servers:
 //  * Include paths from /cvmfs get accepted
 //  * Includes that look like they are (in the) the source directory of the
@@ -34,42 +34,43 @@ import (
 //  * Include paths from the current workspace that look like install
 //    directories of dependencies (built by the same slot) get manipulated to
 //    their expected cvmfs deployment destination
-func Filter_LHCb_public_includes(unfiltered map[string]bool, p Project) (map[string]bool, error) {
+//
+// The order, kind and usage count of the remaining paths is kept.
+func Filter_LHCb_public_includes(unfiltered cc2ce.IncludeSet, p Project) (cc2ce.IncludeSet, error) {
 	filtered, err := Filter_LHCb_includes(unfiltered, p, false)
 	return filtered, err
 }
 
-func Filter_LHCb_includes(unfiltered map[string]bool, p Project, keep_local_includes bool) (map[string]bool, error) {
-	filtered := make(map[string]bool)
+func Filter_LHCb_includes(unfiltered cc2ce.IncludeSet, p Project, keep_local_includes bool) (cc2ce.IncludeSet, error) {
+	var filtered cc2ce.IncludeSet
 	// add the deployed install area of the current project
-	filtered[filepath.Join(Installarea(p), "/include")] = true
-	for inc, boolean := range unfiltered {
-		if !boolean {
-			// this is unexpected input
-			return make(map[string]bool), fmt.Errorf("Filter_LHCb_all_includes unexpected input: false flagged include path")
-		}
-		if strings.HasPrefix(inc, "/cvmfs") {
+	filtered.Add(cc2ce.IncludePath{Path: filepath.Join(Installarea(p), "/include"), Kind: cc2ce.IncludeUser})
+	for _, inc := range unfiltered.Entries() {
+		if strings.HasPrefix(inc.Path, "/cvmfs") {
 			// accept paths from cvmfs
-			filtered[inc] = true
-		} else if strings.Contains(inc, "InstallArea") {
+			filtered.Add(inc)
+		} else if strings.Contains(inc.Path, "InstallArea") {
 			// this looks like the installation area of a dependency project
 			// replace /workspace/build/... by something like
 			// /cvmfs/lhcbdev.cern.ch/nightlies/lhcb-head/Tue/...
 			// where ... looks like GAUDI/GAUDI_master/InstallArea/x86_64+avx2+fma-centos7-gcc7-opt/include
-			filtered[strings.Replace(inc, "/workspace/build/", p.Buildarea()+"/", 1)] = true
-		} else if strings.HasPrefix(inc, filepath.Join("/workspace/build", p.ProjectareaInBuildarea_new())) {
+			inc.Path = strings.Replace(inc.Path, "/workspace/build/", p.Buildarea()+"/", 1)
+			filtered.Add(inc)
+		} else if strings.HasPrefix(inc.Path, filepath.Join("/workspace/build", p.ProjectareaInBuildarea_new())) {
 			// should be the source of the current project (in a new - i.e. nightlies - build area)
 			if keep_local_includes {
-				filtered[strings.Replace(inc, "/workspace/build/", p.Buildarea()+"/", 1)] = true
+				inc.Path = strings.Replace(inc.Path, "/workspace/build/", p.Buildarea()+"/", 1)
+				filtered.Add(inc)
 			}
-		} else if strings.HasPrefix(inc, filepath.Join("/workspace/build", p.ProjectareaInBuildarea_old())) {
+		} else if strings.HasPrefix(inc.Path, filepath.Join("/workspace/build", p.ProjectareaInBuildarea_old())) {
 			// should be the source of the current project (in an old - i.e. old released - build area)
 			if keep_local_includes {
-				filtered[strings.Replace(inc, "/workspace/build/", p.Buildarea()+"/", 1)] = true
+				inc.Path = strings.Replace(inc.Path, "/workspace/build/", p.Buildarea()+"/", 1)
+				filtered.Add(inc)
 			}
-		} else if inc != "" {
+		} else if inc.Path != "" {
 			// includes which are none of the above are unexpected
-			return make(map[string]bool), fmt.Errorf("Unexpected include path for LHCb nightly treatment: %s", inc)
+			return cc2ce.IncludeSet{}, fmt.Errorf("Unexpected include path for LHCb nightly treatment: %s", inc.Path)
 		}
 	}
 	return filtered, nil
@@ -122,21 +123,19 @@ func (p *Project) GenerateIncludes() error {
 	if err != nil {
 		return err
 	}
-	p.IncludeMap = incs
+	p.Includes = incs
 	return nil
 }
 
-func Parse_and_generate(p Project, nightlyroot, cmtconfig string) (map[string]bool, error) {
-	stringset := make(map[string]bool)
-
+func Parse_and_generate(p Project, nightlyroot, cmtconfig string) (cc2ce.IncludeSet, error) {
 	unfiltered, err := cc2ce.ParseJsonByFilename(Installarea(p), false)
 	if err != nil {
-		return stringset, err
+		return cc2ce.IncludeSet{}, err
 	}
 
 	filtered, err := Filter_LHCb_public_includes(unfiltered, p)
 	if err != nil {
-		return stringset, err
+		return cc2ce.IncludeSet{}, err
 	}
 
 	return filtered, nil
@@ -150,13 +149,13 @@ func Parse_and_generate(p Project, nightlyroot, cmtconfig string) (map[string]bo
 // * Project must be all upper case
 // * Day is the number of the build as string, or the shorthand symlink name (e.g. "Today")
 // * Slot is the slot of the nightly build system (e.g. lhcb-head or lhcb-gaudi-head)
-// * IncludeMap is the quasi-set of all include paths (the installed ones and the dependencies)
+// * Includes is the ordered set of all include paths (the installed ones and the dependencies)
 type Project struct {
-	Slot       string
-	Day        string
-	Project    string
-	Version    string
-	IncludeMap map[string]bool
+	Slot     string
+	Day      string
+	Project  string
+	Version  string
+	Includes cc2ce.IncludeSet
 }
 
 func (p *Project) ConfVersion() string {
@@ -28,10 +28,14 @@ func Create(ps []Project, outname string) {
 		os.Exit(8)
 	}
 	unique_project_names := make(map[string]bool)
+	var ordered_project_names []string
 	for _, p := range ps {
+		if !unique_project_names[p.CE_config_name()] {
+			ordered_project_names = append(ordered_project_names, p.CE_config_name())
+		}
 		unique_project_names[p.CE_config_name()] = true
 	}
-	project_names := cc2ce.ColonSeparateMap(unique_project_names)
+	project_names := cc2ce.ColonSeparateArray(ordered_project_names)
 
 	f, err := write.TempFile("", outname)
 	if err != nil {
@@ -92,7 +96,7 @@ func Create(ps []Project, outname string) {
 			}
 		}
 		pr("version", p.ConfVersion())
-		pr("path", cc2ce.ColonSeparateMap(p.IncludeMap))
+		pr("path", p.Includes.ColonSeparated())
 	}
 	if err := f.CloseAtomicallyReplace(); err != nil {
 		log.Printf("writing %s: %v", outname, err)
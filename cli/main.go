@@ -16,8 +16,10 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 
 	write "github.com/google/renameio"
@@ -25,94 +27,520 @@ import (
 )
 
 type CompilerConfig struct {
-	Exe      string
-	Name     string
-	ConfName string
-	Options  string
+	Exe          string
+	Name         string
+	ConfName     string
+	Options      string
+	CompilerType string
+	Semver       string
+	EnvVars      string
+	Family       string // for grouping, e.g. "gcc" or "clang"
+	WrapperArgs  string // what a resolved wrapper passed, see setOptions
 }
 
-func CompilerFromJsonByDB(db []cc2ce.JsonTranslationunit) (string, error) {
-	var b bytes.Buffer
-	for _, tu := range db {
-		words := strings.Fields(tu.Command)
-		for i, w := range words {
-			if strings.HasPrefix(w, "-") || strings.HasSuffix(w, ".cpp") {
-				break
+// setOptions sets the options of a compiler, after the arguments its
+// resolved wrapper script passed to it.
+func (c *CompilerConfig) setOptions(options string) {
+	c.Options = strings.TrimSpace(c.WrapperArgs + " " + options)
+}
+
+// probeCall is the compiler call for running the compiler, with the
+// environment a resolved wrapper script set up for it.
+func (c CompilerConfig) probeCall() string {
+	if c.EnvVars == "" {
+		return c.Exe
+	}
+	return "env " + cc2ce.JoinArguments(strings.Split(c.EnvVars, ":")) + " " + cc2ce.QuoteArgument(c.Exe)
+}
+
+// configSettings are the command line settings for creating compiler
+// configurations.
+type configSettings struct {
+	consensus       float64
+	cache           *cc2ce.CompilerCache
+	resolveWrappers bool
+	cluster         int
+	extraCompilers  []string
+	probeFlags      bool
+}
+
+// compilerConfig creates the configuration of one compiler from the
+// translation units of a language compiled with it.
+func (s configSettings) compilerConfig(g cc2ce.CompilerGroup, language string) (CompilerConfig, error) {
+	compiler := CompilerConfig{Exe: g.Compiler}
+	var options string
+	var err error
+	if s.consensus == 0 {
+		options, err = cc2ce.OptionsFromCommands(g.Commands, false)
+	} else {
+		var c cc2ce.OptionConsensus
+		c, err = cc2ce.ConsensusOptionsFromCommands(g.Commands, s.consensus, false)
+		options = c.Options
+		for _, d := range c.Dropped {
+			log.Printf("dropping translation unit specific option %s (used by %d of %d translation units)", d.Option, d.Uses, c.TranslationUnits)
+		}
+	}
+	if err != nil {
+		return compiler, err
+	}
+
+	info, err := s.cache.Probe(compiler.Exe, language)
+	if err != nil {
+		log.Printf("Could not probe compiler %s: %v", compiler.Exe, err)
+		info = cc2ce.CompilerInfo{Exe: compiler.Exe, Family: cc2ce.GuessCompilerFamily(compiler.Exe)}
+	}
+	compiler.Name = info.Name()
+	compiler.ConfName = info.ID()
+	compiler.CompilerType = info.CompilerType()
+	compiler.Semver = info.Version
+	compiler.Family = info.Family
+
+	if s.resolveWrappers {
+		if res, found, err := cc2ce.ResolveCompilerWrapper(compiler.Exe); err != nil {
+			log.Printf("Could not resolve compiler wrapper %s: %v", compiler.Exe, err)
+		} else if found {
+			if envvars, err := res.EnvVars(); err != nil {
+				log.Printf("Keeping compiler wrapper %s: %v", compiler.Exe, err)
+			} else {
+				log.Printf("Resolved compiler wrapper %s to %s", compiler.Exe, res.Compiler)
+				compiler.Exe = res.Compiler
+				compiler.EnvVars = envvars
+				compiler.WrapperArgs = cc2ce.JoinOptions(res.Args)
 			}
-			if i != 0 {
-				b.WriteString(" ")
+		}
+	}
+	compiler.setOptions(options)
+	return compiler, nil
+}
+
+// uniqueNames tells apart the names and IDs of compilers of the same
+// family and version (such as gcc and g++): the executable's name is added
+// to them. This doesn't make them unique, see uniqueIDs.
+func uniqueNames(confs []CompilerConfig) {
+	uses := make(map[string]int)
+	for _, c := range confs {
+		uses[c.ConfName]++
+	}
+	for i, c := range confs {
+		if uses[c.ConfName] < 2 {
+			continue
+		}
+		exe := c.Exe
+		if call, err := cc2ce.SplitCommand(exe); err == nil && len(call) != 0 {
+			exe = call[len(call)-1]
+		}
+		confs[i].Name = c.Name + " (" + filepath.Base(exe) + ")"
+		confs[i].ConfName = confName(confs[i].Name)
+	}
+}
+
+// uniqueIDs makes the IDs of compilers unique where uniqueNames didn't,
+// such as for two g++ of the same version in different directories, or
+// clusters with the same name: all but the first get a number appended, to
+// their ID and name.
+func uniqueIDs(confs []CompilerConfig) {
+	taken := make(map[string]bool)
+	for _, c := range confs {
+		taken[c.ConfName] = true
+	}
+	seen := make(map[string]bool)
+	for i, c := range confs {
+		if seen[c.ConfName] {
+			for n := 2; ; n++ {
+				id := fmt.Sprintf("%s_%d", c.ConfName, n)
+				if !taken[id] {
+					confs[i].ConfName = id
+					confs[i].Name = fmt.Sprintf("%s (%d)", c.Name, n)
+					taken[id] = true
+					break
+				}
+			}
+		}
+		seen[confs[i].ConfName] = true
+	}
+}
+
+// languageConfigs creates the configurations of the compilers of one
+// language. Compiler IDs of languages other than C++ get the language as
+// prefix, as IDs must be unique across all languages in Compiler Explorer.
+//
+// For C++, the extra compilers get the options of the first compiler. The
+// options of all compilers are translated to what each compiler
+// understands, see cc2ce.TranslateOptions, and with probeFlags checked by
+// compiling with each flag, see cc2ce.CompilerCache.SupportedOptions.
+//
+// With clustering, the options of each cluster are those of its largest
+// group of translation units (see cc2ce.ClusterByOptions), the consensus
+// setting doesn't apply to them.
+func (s configSettings) languageConfigs(lg cc2ce.LanguageGroup, libname string) ([]CompilerConfig, error) {
+	groups := cc2ce.GroupByCompiler(lg.Commands)
+	if lg.Language == cc2ce.LanguageCpp && len(groups) != 0 {
+		known := make(map[string]bool)
+		for _, g := range groups {
+			known[g.Compiler] = true
+		}
+		for _, extra := range s.extraCompilers {
+			exe, err := cc2ce.CompilerFromCommands([]cc2ce.CompileCommand{{Compiler: extra}})
+			if err != nil {
+				return nil, err
+			}
+			if known[exe] {
+				continue
+			}
+			known[exe] = true
+			groups = append(groups, cc2ce.CompilerGroup{Compiler: exe, Commands: groups[0].Commands})
+		}
+	}
+	var compilers []CompilerConfig
+	for _, g := range groups {
+		compiler, err := s.compilerConfig(g, lg.Language)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", g.Compiler, err)
+		}
+		compilers = append(compilers, compiler)
+	}
+	uniqueNames(compilers)
+	if s.cluster >= 0 {
+		if s.consensus != 0 {
+			log.Printf("Ignoring -consensus for %s: with -cluster, each cluster uses the options of its largest group of translation units", lg.Language)
+		}
+		var clustered []CompilerConfig
+		for i, g := range groups {
+			name := libname
+			if len(groups) > 1 {
+				name = libname + " " + compilers[i].Name
 			}
-			b.WriteString(w)
+			clustered = append(clustered, ClusteredConfigs(compilers[i], cc2ce.ClusterByOptions(g.Commands, s.cluster, false), name)...)
 		}
-		return b.String(), nil
+		compilers = clustered
+	}
+	prefix := languagePrefix(lg.Language)
+	for i := range compilers {
+		compilers[i].ConfName = prefix + compilers[i].ConfName
 	}
-	return "", fmt.Errorf("no translation units found")
+	uniqueIDs(compilers)
+	for i := range compilers {
+		var adjustments []cc2ce.OptionAdjustment
+		compilers[i].Options, adjustments = cc2ce.TranslateOptions(compilers[i].Options, compilers[i].Family, compilers[i].Semver)
+		for _, a := range adjustments {
+			log.Printf("%s: %s", compilers[i].Name, a)
+		}
+		if s.probeFlags && compilers[i].Family != "nvcc" {
+			options, removed, err := s.cache.SupportedOptions(compilers[i].probeCall(), lg.Language, compilers[i].Options)
+			if err != nil {
+				log.Printf("%s: Could not check flags: %v", compilers[i].Name, err)
+				continue
+			}
+			compilers[i].Options = options
+			for _, r := range removed {
+				log.Printf("%s: dropped unsupported %s", compilers[i].Name, r)
+			}
+		}
+	}
+	return compilers, nil
+}
+
+// languagePrefix returns the prefix of compiler and group IDs for a
+// language, e.g. "c_" for C. C++ IDs have no prefix.
+func languagePrefix(language string) string {
+	if language == cc2ce.LanguageCpp {
+		return ""
+	}
+	return confName(language) + "_"
+}
+
+// ClusteredConfigs creates one compiler configuration per option cluster,
+// based on the configuration base. The clusters are named after the library.
+// The arguments of a resolved wrapper stay in front of the options of each
+// cluster.
+func ClusteredConfigs(base CompilerConfig, clusters []cc2ce.OptionCluster, libname string) []CompilerConfig {
+	var confs []CompilerConfig
+	for _, cl := range clusters {
+		c := base
+		c.setOptions(cl.Options)
+		c.Name = cl.Name(libname)
+		c.ConfName = confName(c.Name)
+		log.Printf("%s: %d translation units", c.Name, len(cl.Commands))
+		confs = append(confs, c)
+	}
+	return confs
+}
+
+// confName turns a display name into something usable as compiler ID in
+// the CE configuration, e.g. "Brunel (linker library)" into
+// "brunel_linker_library".
+func confName(name string) string {
+	var b bytes.Buffer
+	underscore := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if underscore && b.Len() != 0 {
+				b.WriteRune('_')
+			}
+			underscore = false
+			b.WriteRune(r)
+		} else {
+			underscore = true
+		}
+	}
+	return b.String()
+}
+
+// stringList is a flag that can be given several times.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
 }
 
 func main() {
 	var lib cc2ce.Library
-	var dbpath string
-	flag.StringVar(&dbpath, "p", ".", "Compilation database path")
+	var dbpaths stringList
+	flag.Var(&dbpaths, "p", "Compilation database path (file, directory, - for stdin, possibly compressed or inside a .tar/.zip archive, a clangd compile_flags.txt, a CMake File API reply, or a meson-info directory), can be given several times and be a glob pattern to merge databases (default .)")
 	flag.StringVar(&lib.LibraryName, "l", "local", "Name of library to display in CE")
 	flag.StringVar(&lib.LibraryUrl, "u", "", "URL to link from CE")
 	flag.StringVar(&lib.LibraryVersion, "version", "master", "version information to display in CE")
-	ofname := flag.String("o", "./c++.local.properties", "output file with CE configuration")
+	ofname := flag.String("o", "./c++.local.properties", "output file with CE configuration. Translation units of other languages go to the file of their language next to it (c.local.properties, cuda.local.properties, fortran.local.properties)")
+	cluster := flag.Int("cluster", -1, "group translation units by compiler options, allowing this many differing options within a group, and write one compiler per group, with the options of the largest set of identical options in the group (-consensus doesn't apply then). -1 writes a single compiler")
+	consensus := flag.Float64("consensus", 0, "only use compiler options shared by this fraction of all translation units (e.g. 1 for all, 0.5 for a majority). 0 uses the options of the first translation unit. Ignored with -cluster")
+	var bazel cc2ce.BazelPaths
+	aquery := flag.String("bazel-aquery", "", "read the CppCompile actions of a bazel aquery --output=jsonproto dump instead of a compilation database")
+	flag.StringVar(&bazel.OutputBase, "bazel-output-base", "", "bazel output base (see bazel info output_base) to locate the files of -bazel-aquery")
+	flag.StringVar(&bazel.Workspace, "bazel-workspace", cc2ce.BazelDefaultWorkspace, "name of the main repository in the bazel execroot")
+	flag.StringVar(&bazel.SourceRoot, "bazel-source-root", "", "location of the sources of the main repository (default: the bazel execroot)")
+	var pkgconfig stringList
+	flag.Var(&pkgconfig, "pkg-config", "write a library for this pkg-config package (from its .pc file) instead of reading a compilation database, can be given several times")
+	pkgconfigpath := flag.String("pkg-config-path", os.Getenv("PKG_CONFIG_PATH"), "colon separated directories with .pc files for -pkg-config")
+	defaultcache, err := cc2ce.DefaultCompilerCachePath()
+	if err != nil {
+		defaultcache = ""
+	}
+	cachefile := flag.String("compiler-cache", defaultcache, "file to cache what running the compiler found out about it, empty to not cache")
+	resolvewrappers := flag.Bool("resolve-wrappers", false, "if the compiler is a wrapper script (such as lcg-g++-X), use the compiler it runs and pass the environment it sets up through envVars")
+	definerules := flag.String("define-rules", "gaudi", "rules for dropping, keeping, rewriting or pinning defines: a preset (gaudi, none) or a json file with rules")
+	var extracompilers stringList
+	flag.Var(&extracompilers, "add-compiler", "also offer this C++ compiler, with the options of the first compiler of the database translated to what it understands, can be given several times")
+	probeflags := flag.Bool("probe-flags", false, "check each compiler option by compiling an empty file with it and -Werror, and drop those a compiler doesn't support (results are kept in the -compiler-cache)")
+	flagpolicy := flag.String("flag-policy", "", "json file with categories and patterns of flags to allow or deny as compiler options")
+	var allowflags, denyflags stringList
+	flag.Var(&allowflags, "allow-flags", "allow a category of flags (define, undefine, standard, target, optimization, warning, diagnostics, codegen, debug, instrumentation, ...) or the flags matching a pattern (e.g. '-fsanitize=*') as compiler options, can be given several times")
+	flag.Var(&denyflags, "deny-flags", "deny a category of flags or the flags matching a pattern as compiler options, overriding -allow-flags, can be given several times")
 	flag.Parse()
-	var err error
+	if *flagpolicy != "" {
+		cc2ce.DefaultFlagPolicy, err = cc2ce.FlagPolicyByFilename(*flagpolicy)
+		if err != nil {
+			log.Printf("Could not read flag policy: %v", err)
+			os.Exit(1)
+		}
+	}
+	for _, item := range allowflags {
+		if err := cc2ce.DefaultFlagPolicy.Allow(item); err != nil {
+			log.Printf("Invalid -allow-flags: %v", err)
+			os.Exit(1)
+		}
+	}
+	for _, item := range denyflags {
+		if err := cc2ce.DefaultFlagPolicy.Deny(item); err != nil {
+			log.Printf("Invalid -deny-flags: %v", err)
+			os.Exit(1)
+		}
+	}
+	cc2ce.DefaultDefineRules, err = cc2ce.DefineRulesByName(*definerules)
+	if err != nil {
+		log.Printf("Could not read define rules: %v", err)
+		os.Exit(1)
+	}
+	if len(pkgconfig) != 0 {
+		libs, err := cc2ce.PkgConfigLibraries(pkgconfig, *pkgconfigpath)
+		if err != nil {
+			log.Printf("Could not read pkg-config packages: %v", err)
+			os.Exit(1)
+		}
+		os.Exit(writeLibraries(libs, *ofname))
+	}
 	turnAbsolute := true
-	db, err := cc2ce.JsonTUsByFilename(dbpath)
+	if len(dbpaths) == 0 {
+		dbpaths = stringList{"."}
+	}
+	paths, err := cc2ce.ExpandDatabasePaths(dbpaths)
 	if err != nil {
-		log.Printf("Could not read compile_commands.json: %v", err)
+		log.Printf("Could not find compile_commands.json: %v", err)
 		os.Exit(1)
 	}
-	lib.Paths, err = cc2ce.IncludesFromJsonByDB(db, turnAbsolute)
+	var db []cc2ce.JsonTranslationunit
+	if *aquery != "" {
+		db, err = cc2ce.BazelAqueryTUsByFilename(*aquery, bazel)
+		if err != nil {
+			log.Printf("Could not read bazel actions: %v", err)
+			os.Exit(1)
+		}
+	} else {
+		var report cc2ce.MergeReport
+		db, report, err = cc2ce.MergeDatabases(paths, turnAbsolute)
+		if err != nil {
+			log.Printf("Could not read compile_commands.json: %v", err)
+			os.Exit(1)
+		}
+		if len(paths) > 1 {
+			log.Printf("merged compilation databases:\n%s", report)
+		}
+		for _, d := range report.Databases {
+			if d.Conflicts != 0 {
+				log.Printf("%s: ignored %d entries compiled differently in an earlier database", d.Path, d.Conflicts)
+			}
+		}
+	}
+	cmds, err := cc2ce.CompileCommandsFromDB(db)
 	if err != nil {
-		log.Printf("reading of include paths failed: %v", err)
+		log.Printf("Could not interpret compile_commands.json: %v", err)
 		os.Exit(1)
 	}
+	var cache *cc2ce.CompilerCache
+	if *cachefile != "" {
+		cache, err = cc2ce.OpenCompilerCache(*cachefile)
+		if err != nil {
+			log.Printf("Ignoring compiler cache: %v", err)
+			cache = nil
+		}
+	}
+	settings := configSettings{consensus: *consensus, cache: cache, resolveWrappers: *resolvewrappers, cluster: *cluster, extraCompilers: extracompilers, probeFlags: *probeflags}
+	languages := cc2ce.GroupByLanguage(cmds)
+	if len(languages) == 0 {
+		log.Printf("Error obtaining compiler options: no translation units found")
+		os.Exit(1)
+	}
+
+	code := settings.writeLanguages(lib, languages, *ofname, turnAbsolute)
+	if err := cache.Save(); err != nil {
+		log.Printf("Could not write compiler cache: %v", err)
+	}
+	os.Exit(code)
+}
 
-	var compiler CompilerConfig
-	compiler.Exe, err = CompilerFromJsonByDB(db)
-	compiler.Options, err = cc2ce.OptionsFromJsonByDB(db, false)
-	compiler.Name = "hardcoded"
-	compiler.ConfName = "hardcoded"
+// writeLanguages writes the library and compiler configuration of each
+// language to the file of the language, see cc2ce.LanguageFilename. Files
+// of languages without translation units that exist from an earlier run are
+// emptied, such that they don't configure stale compilers. The files are
+// replaced as one set, see cc2ce.OutputSet. It returns the exit code.
+func (s configSettings) writeLanguages(lib cc2ce.Library, languages []cc2ce.LanguageGroup, ofname string, turnAbsolute bool) int {
+	outputs, err := cc2ce.NewOutputSet(ofname)
 	if err != nil {
-		log.Printf("Error obtaining compiler options: %v", err)
-		os.Exit(1)
+		log.Printf("Couldn't prepare output writing: %v", err)
+		return 5
+	}
+	defer outputs.Cleanup()
+	var written []string
+	present := make(map[string]bool)
+	for _, lg := range languages {
+		present[lg.Language] = true
+		langlib := lib
+		langlib.Paths = cc2ce.IncludesFromCommands(lg.Commands, turnAbsolute)
+		compilers, err := s.languageConfigs(lg, lib.LibraryName)
+		if err != nil {
+			log.Printf("Error obtaining %s compiler options: %v", lg.Language, err)
+			return 1
+		}
+		fname := cc2ce.LanguageFilename(ofname, lg.Language)
+		written = append(written, fmt.Sprintf("%s: %d translation units written to %s", lg.Language, len(lg.Commands), fname))
+		f, err := outputs.Create(fname)
+		if err != nil {
+			return 5
+		}
+		if err := cc2ce.WriteSingleLibraryAndVersionToFile(langlib, f); err != nil {
+			log.Printf("Error writing library config: %v", err)
+			return 5
+		}
+		if err := WriteConfig(compilers, languagePrefix(lg.Language), f); err != nil {
+			log.Printf("Error writing compiler config: %v", err)
+			return 5
+		}
 	}
+	for _, language := range cc2ce.Languages {
+		fname := cc2ce.LanguageFilename(ofname, language)
+		if present[language] {
+			continue
+		}
+		if _, err := os.Stat(fname); err != nil {
+			continue
+		}
+		written = append(written, fmt.Sprintf("%s: no translation units, emptied %s", language, fname))
+		if _, err := outputs.Create(fname); err != nil {
+			return 5
+		}
+	}
+	if err := outputs.Commit(); err != nil {
+		return 5
+	}
+	for _, w := range written {
+		log.Print(w)
+	}
+	return 0
+}
 
-	f, err := write.TempFile("", *ofname)
+// writeLibraries writes the configuration for libraries without compilers
+// and returns the exit code.
+func writeLibraries(libs []cc2ce.Library, ofname string) int {
+	f, err := write.TempFile("", ofname)
 	if err != nil {
 		log.Printf("Couldn't create tempfile for output writing: %v", err)
-		os.Exit(5)
+		return 5
 	}
-	err = cc2ce.WriteSingleLibraryAndVersionToFile(lib, f)
-	if err != nil {
+	defer f.Cleanup()
+	if err := cc2ce.WriteLibrariesToFile(libs, f); err != nil {
 		log.Printf("Error writing library config: %v", err)
-		f.Cleanup()
-		os.Exit(5)
-	}
-	err = WriteConfig([]CompilerConfig{compiler}, f)
-	if err != nil {
-		log.Printf("Error writing compiler config: %v", err)
-		f.Cleanup()
-		os.Exit(5)
+		return 5
 	}
 	if err := f.CloseAtomicallyReplace(); err != nil {
-		log.Printf("writing %s failed: %v", *ofname, err)
-		f.Cleanup()
-		os.Exit(5)
+		log.Printf("writing %s failed: %v", ofname, err)
+		return 5
 	}
-	f.Cleanup()
-	os.Exit(0)
+	return 0
 }
 
-func WriteConfig(confs []CompilerConfig, f *write.PendingFile) error {
-	fmt.Fprintf(f, "compilers=&autogen\n")
+// familyGroups sorts compilers into groups by family, in the order in which
+// the families first occur. Compilers of unknown family go to the group
+// "autogen". The group IDs get prefix, see languagePrefix.
+func familyGroups(confs []CompilerConfig, prefix string) ([]string, map[string][]CompilerConfig) {
+	var ids []string
+	groups := make(map[string][]CompilerConfig)
+	for _, c := range confs {
+		id := confName(c.Family)
+		if id == "" {
+			id = "autogen"
+		}
+		id = prefix + id
+		if _, found := groups[id]; !found {
+			ids = append(ids, id)
+		}
+		groups[id] = append(groups[id], c)
+	}
+	return ids, groups
+}
+
+func WriteConfig(confs []CompilerConfig, prefix string, f io.Writer) error {
+	ids, groups := familyGroups(confs, prefix)
 	{
+		var b bytes.Buffer
+		for i, id := range ids {
+			if i != 0 {
+				b.WriteString(":")
+			}
+			b.WriteString("&" + id)
+		}
+		if _, err := fmt.Fprintf(f, "compilers=%s\n", b.String()); err != nil {
+			log.Printf("Error writing to config: %v", err)
+			return err
+		}
+	}
+	for _, id := range ids {
 		var b bytes.Buffer
 		addseparator := false
-		for _, c := range confs {
+		for _, c := range groups[id] {
 			if addseparator {
 				b.WriteString(":")
 			} else {
@@ -120,14 +548,18 @@ func WriteConfig(confs []CompilerConfig, f *write.PendingFile) error {
 			}
 			b.WriteString(c.ConfName)
 		}
-		if _, err := fmt.Fprintf(f, "group.autogen.compilers=%s\n", b.String()); err != nil {
+		if _, err := fmt.Fprintf(f, "group.%s.compilers=%s\n", id, b.String()); err != nil {
+			log.Printf("Error writing to config: %v", err)
+			return err
+		}
+		groupname := "auto-generated compiler settings"
+		if groups[id][0].Family != "" {
+			groupname = "auto-generated " + groups[id][0].Family + " compiler settings"
+		}
+		if _, err := fmt.Fprintf(f, "group.%s.groupName=%s\n", id, groupname); err != nil {
 			log.Printf("Error writing to config: %v", err)
 			return err
 		}
-	}
-	if _, err := fmt.Fprint(f, "group.autogen.groupName=auto-generated compiler settings\n"); err != nil {
-		log.Printf("Error writing to config: %v", err)
-		return err
 	}
 	compiler_writer := func(c CompilerConfig) error {
 		if _, err := fmt.Fprintf(f, "compiler.%s.name=%s\n", c.ConfName, c.Name); err != nil {
@@ -142,6 +574,24 @@ func WriteConfig(confs []CompilerConfig, f *write.PendingFile) error {
 			log.Printf("Error writing to config: %v", err)
 			return err
 		}
+		if c.CompilerType != "" {
+			if _, err := fmt.Fprintf(f, "compiler.%s.compilerType=%s\n", c.ConfName, c.CompilerType); err != nil {
+				log.Printf("Error writing to config: %v", err)
+				return err
+			}
+		}
+		if c.EnvVars != "" {
+			if _, err := fmt.Fprintf(f, "compiler.%s.envVars=%s\n", c.ConfName, c.EnvVars); err != nil {
+				log.Printf("Error writing to config: %v", err)
+				return err
+			}
+		}
+		if c.Semver != "" {
+			if _, err := fmt.Fprintf(f, "compiler.%s.semver=%s\n", c.ConfName, c.Semver); err != nil {
+				log.Printf("Error writing to config: %v", err)
+				return err
+			}
+		}
 		return nil
 	}
 	for _, c := range confs {
@@ -0,0 +1,151 @@
+/*
+ * Copyright (C) 2018  CERN for the benefit of the LHCb collaboration
+ * Author: Paul Seyfert <pseyfert@cern.ch>
+ *
+ * This software is distributed under the terms of the GNU General Public
+ * Licence version 3 (GPL Version 3), copied verbatim in the file "LICENSE".
+ *
+ * In applying this licence, CERN does not waive the privileges and immunities
+ * granted to it by virtue of its status as an Intergovernmental Organization
+ * or submit itself to any jurisdiction.
+ */
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pseyfert/compilecommands_to_compilerexplorer/cc2ce"
+)
+
+// writeWrappedCompiler creates a compiler that only works in the
+// environment its wrapper sets up, and rejects -Wunsupported, and the
+// wrapper script, which passes -m64. It returns the paths of both.
+func writeWrappedCompiler(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	compiler := filepath.Join(dir, "gcc", "bin", "g++")
+	if err := os.MkdirAll(filepath.Dir(compiler), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// not a wrapper itself, as it has an if
+	compilerScript := `#!/bin/sh
+if [ "$FAKE_GCC_SETUP" != yes ]; then
+  echo "error while loading shared libraries" >&2
+  exit 127
+fi
+for a in "$@"; do
+  case "$a" in
+  -Wunsupported) echo "unrecognized command-line option $a" >&2; exit 1;;
+  esac
+done
+exit 0
+`
+	if err := ioutil.WriteFile(compiler, []byte(compilerScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+	wrapper := filepath.Join(dir, "lcg-g++")
+	wrapperScript := "#!/bin/sh\nexport FAKE_GCC_SETUP=yes\nexec " + compiler + " -m64 \"$@\"\n"
+	if err := ioutil.WriteFile(wrapper, []byte(wrapperScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return compiler, wrapper
+}
+
+func TestWrapperClusterProbe(t *testing.T) {
+	compiler, wrapper := writeWrappedCompiler(t)
+	db := []cc2ce.JsonTranslationunit{
+		{Builddir: "/b", File: "a.cpp", Arguments: []string{wrapper, "-O2", "-Wunsupported", "-c", "a.cpp"}},
+		{Builddir: "/b", File: "b.cpp", Arguments: []string{wrapper, "-O2", "-Wunsupported", "-c", "b.cpp"}},
+		{Builddir: "/b", File: "c.cpp", Arguments: []string{wrapper, "-O3", "-c", "c.cpp"}},
+	}
+	cmds, err := cc2ce.CompileCommandsFromDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := configSettings{resolveWrappers: true, cluster: 0, probeFlags: true}
+	confs, err := s.languageConfigs(cc2ce.LanguageGroup{Language: cc2ce.LanguageCpp, Commands: cmds}, "lib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"-m64 -O2", "-m64 -O3"}
+	if len(confs) != len(want) {
+		t.Fatalf("got %d compilers, want %d: %+v", len(confs), len(want), confs)
+	}
+	for i, c := range confs {
+		if c.Exe != compiler || c.EnvVars != "FAKE_GCC_SETUP=yes" {
+			t.Errorf("%d: got compiler %s with envVars %q", i, c.Exe, c.EnvVars)
+		}
+		if c.Options != want[i] {
+			t.Errorf("%d: got options %q, want %q", i, c.Options, want[i])
+		}
+	}
+}
+
+func TestWrapperArgsWithoutCluster(t *testing.T) {
+	_, wrapper := writeWrappedCompiler(t)
+	db := []cc2ce.JsonTranslationunit{
+		{Builddir: "/b", File: "a.cpp", Arguments: []string{wrapper, "-O2", "-c", "a.cpp"}},
+	}
+	cmds, err := cc2ce.CompileCommandsFromDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := configSettings{resolveWrappers: true, cluster: -1}
+	confs, err := s.languageConfigs(cc2ce.LanguageGroup{Language: cc2ce.LanguageCpp, Commands: cmds}, "lib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(confs) != 1 || confs[0].Options != "-m64 -O2" {
+		t.Errorf("got %+v", confs)
+	}
+}
+
+func TestClusterIgnoresConsensus(t *testing.T) {
+	_, wrapper := writeWrappedCompiler(t)
+	db := []cc2ce.JsonTranslationunit{
+		{Builddir: "/b", File: "a.cpp", Arguments: []string{wrapper, "-O2", "-DA", "-c", "a.cpp"}},
+		{Builddir: "/b", File: "b.cpp", Arguments: []string{wrapper, "-O2", "-DA", "-c", "b.cpp"}},
+		{Builddir: "/b", File: "c.cpp", Arguments: []string{wrapper, "-O2", "-DB", "-Wall", "-c", "c.cpp"}},
+	}
+	cmds, err := cc2ce.CompileCommandsFromDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	tests := []struct {
+		name    string
+		s       configSettings
+		options []string
+		warning bool
+	}{
+		{"consensus", configSettings{consensus: 1, cluster: -1}, []string{"-O2"}, false},
+		{"cluster", configSettings{cluster: 0}, []string{"-O2 -DA", "-O2 -DB -Wall"}, false},
+		{"cluster and consensus", configSettings{consensus: 1, cluster: 0}, []string{"-O2 -DA", "-O2 -DB -Wall"}, true},
+	}
+	for _, tt := range tests {
+		logged.Reset()
+		confs, err := tt.s.languageConfigs(cc2ce.LanguageGroup{Language: cc2ce.LanguageCpp, Commands: cmds}, "lib")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var options []string
+		for _, c := range confs {
+			options = append(options, c.Options)
+		}
+		if strings.Join(options, "|") != strings.Join(tt.options, "|") {
+			t.Errorf("%s: got options %q, want %q", tt.name, options, tt.options)
+		}
+		if warned := strings.Contains(logged.String(), "Ignoring -consensus"); warned != tt.warning {
+			t.Errorf("%s: got warning %v, want %v in %q", tt.name, warned, tt.warning, logged.String())
+		}
+	}
+}
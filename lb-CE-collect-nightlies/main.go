@@ -52,7 +52,7 @@ func main() {
 							os.Exit(7)
 						}
 					} else {
-						p.IncludeMap = incs
+						p.Includes = incs
 						projects = append(projects, p)
 					}
 				}
@@ -18,7 +18,6 @@ import (
 	"log"
 	"os"
 
-	"github.com/pseyfert/compilecommands_to_compilerexplorer/cc2ce"
 	"github.com/pseyfert/compilecommands_to_compilerexplorer/cc2ce4lhcb"
 )
 
@@ -40,8 +39,8 @@ func main() {
 		os.Exit(1)
 	}
 
-	p.IncludeMap = incs
+	p.Includes = incs
 
-	fmt.Println(cc2ce.ColonSeparateMap(p.IncludeMap))
+	fmt.Println(p.Includes.ColonSeparated())
 	cc2ce4lhcb.Create([]cc2ce4lhcb.Project{p}, conffilename)
 }